@@ -0,0 +1,123 @@
+package iago
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// PasswordCallback returns the password of user on the host with the given
+// SSH config alias.
+type PasswordCallback func(host, user string) (string, error)
+
+// KeyboardInteractiveCallback answers the questions of a keyboard-interactive
+// challenge sent to user by the host with the given SSH config alias, such as
+// a prompt for a one-time password. It must return one answer per question;
+// echos reports whether the answer to each question may be shown as it is
+// typed. See [ssh.KeyboardInteractiveChallenge] for the other arguments.
+type KeyboardInteractiveCallback func(host, user, name, instruction string, questions []string, echos []bool) ([]string, error)
+
+// PasswordAuth returns a [GroupOption] that lets [NewSSHGroup] authenticate
+// with the passwords returned by callback, for hosts that do not accept a
+// public key, such as fresh virtual machines before keys are installed. The
+// callback is called on each attempt, for jump hosts too, and may be called
+// concurrently with [DialConcurrency]. Hosts with "PasswordAuthentication no"
+// in the SSH config do not use it.
+func PasswordAuth(callback PasswordCallback) GroupOption {
+	return func(cfg *groupConfig) {
+		cfg.password = callback
+	}
+}
+
+// KeyboardInteractiveAuth returns a [GroupOption] that lets [NewSSHGroup]
+// answer keyboard-interactive challenges with callback, as with
+// [PasswordAuth]. Hosts with "KbdInteractiveAuthentication no" in the SSH
+// config do not use it.
+func KeyboardInteractiveAuth(callback KeyboardInteractiveCallback) GroupOption {
+	return func(cfg *groupConfig) {
+		cfg.keyboardInteractive = callback
+	}
+}
+
+// authMethods returns the methods with which user authenticates with alias,
+// in the order given by PreferredAuthentications. Public keys and user
+// certificates come from the SSH agent, the IdentityFile, decrypted with the
+// group's passphrase callback if it is protected, and the CertificateFiles;
+// passwords and keyboard-interactive answers
+// come from the group's callbacks, if any. Methods this package does not
+// implement, such as gssapi-with-mic and hostbased, are skipped.
+func (cw *sshConfig) authMethods(alias, user string) ([]ssh.AuthMethod, error) {
+	preferred, err := cw.get(alias, "PreferredAuthentications")
+	if err != nil {
+		return nil, err
+	}
+	var (
+		methods []ssh.AuthMethod
+		keyErr  error
+	)
+	seen := make(map[string]bool)
+	for method := range strings.SplitSeq(preferred, ",") {
+		method = strings.ToLower(strings.TrimSpace(method))
+		if seen[method] {
+			continue
+		}
+		seen[method] = true
+		switch method {
+		case "publickey":
+			identityFile, err := cw.get(alias, "IdentityFile")
+			if err != nil {
+				return nil, err
+			}
+			certFiles, err := cw.config.GetAll(alias, "CertificateFile")
+			if err != nil {
+				return nil, fmt.Errorf("iago: failed to get CertificateFile for %s: %w", alias, err)
+			}
+			var signers []ssh.Signer
+			signers, keyErr = cw.keys.publicKeySigners(identityFile, certFiles, user, cw.passphrase)
+			if len(signers) > 0 {
+				methods = append(methods, ssh.PublicKeys(signers...))
+			}
+		case "keyboard-interactive":
+			ok, err := cw.enabled(alias, "KbdInteractiveAuthentication")
+			if err != nil {
+				return nil, err
+			}
+			if callback := cw.keyboardInteractive; ok && callback != nil {
+				methods = append(methods, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+					return callback(alias, user, name, instruction, questions, echos)
+				}))
+			}
+		case "password":
+			ok, err := cw.enabled(alias, "PasswordAuthentication")
+			if err != nil {
+				return nil, err
+			}
+			if callback := cw.password; ok && callback != nil {
+				methods = append(methods, ssh.PasswordCallback(func() (string, error) {
+					return callback(alias, user)
+				}))
+			}
+		}
+	}
+	if len(methods) == 0 {
+		if keyErr != nil {
+			return nil, fmt.Errorf("iago: no valid authentication methods found for %s: %w", alias, keyErr)
+		}
+		return nil, fmt.Errorf("iago: no valid authentication methods found for %s", alias)
+	}
+	if keyErr != nil {
+		cw.warn(fmt.Errorf("iago: %w", keyErr))
+	}
+	return methods, nil
+}
+
+// enabled reports whether the yes/no option key is enabled for alias, which
+// it is unless set to "no".
+func (cw *sshConfig) enabled(alias, key string) (bool, error) {
+	val, err := cw.get(alias, key)
+	if err != nil {
+		return false, err
+	}
+	return !strings.EqualFold(strings.TrimSpace(val), "no"), nil
+}
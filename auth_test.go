@@ -0,0 +1,129 @@
+package iago
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newAuthTestServer starts a test server that rejects public keys, accepts
+// the password "secret" and the one-time password "123456" by
+// keyboard-interactive authentication, and records the methods that clients
+// try.
+func newAuthTestServer(t *testing.T) (*testServer, func() []string) {
+	var mu sync.Mutex
+	var tried []string
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, errors.New("unknown key")
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+		KeyboardInteractiveCallback: func(_ ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "Enter your one-time password.", []string{"OTP: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 1 || answers[0] != "123456" {
+				return nil, errors.New("wrong one-time password")
+			}
+			return nil, nil
+		},
+		AuthLogCallback: func(_ ssh.ConnMetadata, method string, _ error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if method != "none" {
+				tried = append(tried, method)
+			}
+		},
+	}
+	srv := newTestServer(t, config)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(tried)
+	}
+}
+
+func TestAuthCallbacks(t *testing.T) {
+	var (
+		passwordHosts []string
+		questions     []string
+	)
+	password := PasswordAuth(func(host, user string) (string, error) {
+		passwordHosts = append(passwordHosts, host+" "+user)
+		return "secret", nil
+	})
+	otp := KeyboardInteractiveAuth(func(_, _, _, _ string, qs []string, _ []bool) ([]string, error) {
+		questions = append(questions, qs...)
+		return []string{"123456"}, nil
+	})
+	wrongOTP := KeyboardInteractiveAuth(func(string, string, string, string, []string, []bool) ([]string, error) {
+		return []string{"000000"}, nil
+	})
+
+	tests := []struct {
+		name      string
+		extra     []string
+		opts      []GroupOption
+		wantTried []string
+		wantErr   bool
+	}{
+		{name: "Password", opts: []GroupOption{password}, wantTried: []string{"publickey", "password"}},
+		{name: "KeyboardInteractive", opts: []GroupOption{otp}, wantTried: []string{"publickey", "keyboard-interactive"}},
+		{name: "DefaultOrder", opts: []GroupOption{password, wrongOTP}, wantTried: []string{"publickey", "keyboard-interactive", "password"}},
+		{
+			name:      "Preferred",
+			extra:     []string{"PreferredAuthentications password,keyboard-interactive"},
+			opts:      []GroupOption{password, otp},
+			wantTried: []string{"password"},
+		},
+		{
+			name:      "PasswordDisabled",
+			extra:     []string{"PasswordAuthentication no"},
+			opts:      []GroupOption{password, otp},
+			wantTried: []string{"publickey", "keyboard-interactive"},
+		},
+		{name: "NoCallbacks", wantTried: []string{"publickey"}, wantErr: true},
+		{
+			name:    "NoMethods",
+			extra:   []string{"PreferredAuthentications password"},
+			opts:    []GroupOption{otp},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, tried := newAuthTestServer(t)
+			file := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(file, []byte(srv.configEntry("vm", writeIdentity(t), tt.extra...)), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			g, err := NewSSHGroup([]string{"vm"}, file, append(tt.opts, FailFast())...)
+			if err == nil {
+				_ = g.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSSHGroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := tried(); !slices.Equal(got, tt.wantTried) {
+				t.Errorf("tried methods %q, want %q", got, tt.wantTried)
+			}
+		})
+	}
+	if !slices.Contains(passwordHosts, "vm test") {
+		t.Errorf("password callback called for %q, want host alias and user", passwordHosts)
+	}
+	if !slices.Contains(questions, "OTP: ") {
+		t.Errorf("keyboard-interactive callback got questions %q, want the server's prompt", questions)
+	}
+}
@@ -0,0 +1,160 @@
+package iago
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// BecomeMethod is the privilege escalation program used by [Become].
+type BecomeMethod string
+
+const (
+	// Sudo escalates privileges with sudo(8). It is the default method.
+	Sudo BecomeMethod = "sudo"
+	// Doas escalates privileges with OpenBSD's doas(1).
+	Doas BecomeMethod = "doas"
+)
+
+// ErrBecomePassword is returned when a password is given to a [Become] whose
+// method cannot read it from standard input.
+var ErrBecomePassword = errors.New("become method cannot read a password from stdin")
+
+// Become runs a command, or installs an uploaded file, as another user on the
+// remote host instead of the SSH user. Set it on [Shell] or [Upload]:
+//
+//	iago.Shell{Command: "apt-get update", Become: &iago.Become{}}
+//
+// With [Sudo], a non-empty Password is fed to sudo on standard input ahead of
+// any input of the command, and sudo is told to ignore cached credentials so
+// that it always consumes the password. Leave Password empty for hosts with a
+// NOPASSWD rule; otherwise the password would reach the command's standard
+// input instead. Without a Password, sudo and doas run non-interactively and
+// fail rather than wait for a password that will never arrive.
+type Become struct {
+	// Method is the escalation program to use; empty means [Sudo].
+	Method BecomeMethod
+	// User is the user to run as; empty means root.
+	User string
+	// Password is the password the escalation program asks for, if any.
+	Password string
+}
+
+// command wraps cmd so that it runs through b's escalation program in a POSIX
+// shell as the target user.
+func (b Become) command(cmd string) (string, error) {
+	var args []string
+	switch b.Method {
+	case Sudo, "":
+		args = append(args, string(Sudo))
+		if b.Password != "" {
+			// -k ignores cached credentials so the password is always read, and
+			// -p '' keeps sudo's prompt out of the command's error output.
+			args = append(args, "-S", "-k", "-p", "''")
+		} else {
+			args = append(args, "-n")
+		}
+	case Doas:
+		if b.Password != "" {
+			return "", fmt.Errorf("iago: %s: %w", b.Method, ErrBecomePassword)
+		}
+		args = append(args, string(Doas), "-n")
+	default:
+		return "", fmt.Errorf("iago: unknown become method %q", b.Method)
+	}
+	if b.User != "" {
+		args = append(args, "-u", Quote(b.User))
+	}
+	args = append(args, "--", "sh", "-c", Quote(cmd))
+	return strings.Join(args, " "), nil
+}
+
+// stdin returns the standard input for a command wrapped by [Become.command]:
+// the password line, if any, followed by r.
+func (b Become) stdin(r io.Reader) io.Reader {
+	if b.Password == "" {
+		return r
+	}
+	pw := strings.NewReader(b.Password + "\n")
+	if r == nil {
+		return pw
+	}
+	return io.MultiReader(pw, r)
+}
+
+// Output runs cmd on host as b's target user and returns its captured
+// standard output. It is the privileged counterpart to [Output].
+func (b Become) Output(ctx context.Context, host Host, cmd string) (string, error) {
+	var buf bytes.Buffer
+	err := Shell{Command: cmd, Stdout: &buf, Become: &b}.Apply(ctx, host)
+	return buf.String(), err
+}
+
+// upload uploads u.Src to a private staging directory owned by the SSH user
+// and then copies it into place as b's target user, which applies u.Perm. A
+// target user other than root cannot read the staged copy, so the staging
+// directory is first handed over to it with chown, as root. The staging
+// directory is removed afterwards, whether or not the upload succeeded, even
+// if ctx is canceled.
+func (b Become) upload(ctx context.Context, host Host, u Upload) (err error) {
+	staging, err := Output(ctx, host, "mktemp -d")
+	if err != nil {
+		return fmt.Errorf("iago: failed to create staging directory: %w", err)
+	}
+	staging = strings.TrimSpace(staging)
+	root := Become{Method: b.Method, Password: b.Password}
+	handOver := b.User != "" && b.User != "root"
+	defer func() {
+		rm := Shell{Command: "rm -rf " + Quote(staging)}
+		if handOver {
+			rm.Become = &root
+		}
+		err = errors.Join(err, rm.Apply(context.WithoutCancel(ctx), host))
+	}()
+
+	// Remote paths are joined with path rather than filepath, which would use
+	// backslashes on a Windows control machine.
+	target := path.Join(u.Dest.prefix, u.Dest.path)
+	stage := Path{prefix: staging, path: path.Base(target)}
+	stagePerm := NewPerm(0o600)
+	err = copyAction{src: u.Src, dest: stage, perm: stagePerm.WithDirPerm(0o700)}.Apply(ctx, host)
+	if err != nil {
+		return err
+	}
+	if handOver {
+		chown := Shell{Command: fmt.Sprintf("chown -R %s %s", Quote(b.User), Quote(staging)), Become: &root}
+		if err := chown.Apply(ctx, host); err != nil {
+			return fmt.Errorf("iago: failed to hand staged upload over to %s: %w", b.User, err)
+		}
+	}
+	info, err := os.Stat(u.Src.String())
+	if err != nil {
+		return err
+	}
+	src := path.Join(staging, path.Base(target))
+	return Shell{Command: installCommand(src, target, u.Perm, info.IsDir()), Become: &b}.Apply(ctx, host)
+}
+
+// installCommand returns a shell command that copies the staged file or
+// directory src to dest, creating missing parent directories, and applies perm
+// to the copied files and directories. Copying rather than moving gives new
+// files the target user's ownership.
+func installCommand(src, dest string, perm Perm, isDir bool) string {
+	if isDir {
+		// chmod the copies of the staged entries, found relative to src.
+		chmod := func(kind string, mode os.FileMode) string {
+			return fmt.Sprintf("find . -type %s -exec sh -c %s %s {} +",
+				kind, Quote(fmt.Sprintf(`for f do chmod %o "$0/$f" || exit; done`, mode)), Quote(dest))
+		}
+		return fmt.Sprintf("mkdir -p %s && cp -R %s %s && cd %s && %s && %s",
+			Quote(dest), Quote(src+"/."), Quote(dest), Quote(src),
+			chmod("d", perm.GetDirPerm().Perm()), chmod("f", perm.GetFilePerm().Perm()))
+	}
+	return fmt.Sprintf("mkdir -p %s && cp %s %s && chmod %o %s",
+		Quote(path.Dir(dest)), Quote(src), Quote(dest), perm.GetFilePerm().Perm(), Quote(dest))
+}
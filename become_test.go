@@ -0,0 +1,88 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBecomeCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		become  Become
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "sudo",
+			become: Become{},
+			want:   `sudo -n -- sh -c 'id -u'`,
+		},
+		{
+			name:   "sudo user",
+			become: Become{User: "postgres"},
+			want:   `sudo -n -u 'postgres' -- sh -c 'id -u'`,
+		},
+		{
+			name:   "sudo password",
+			become: Become{Method: Sudo, Password: "secret"},
+			want:   `sudo -S -k -p '' -- sh -c 'id -u'`,
+		},
+		{
+			name:   "doas",
+			become: Become{Method: Doas, User: "www"},
+			want:   `doas -n -u 'www' -- sh -c 'id -u'`,
+		},
+		{
+			name:    "doas password",
+			become:  Become{Method: Doas, Password: "secret"},
+			wantErr: ErrBecomePassword,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.become.command("id -u")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("command() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("command() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellBecomeFeedsPassword(t *testing.T) {
+	runner := &fakeCmdRunner{stdin: &strings.Builder{}}
+	host := fakeHost{name: "h", cmd: runner}
+	err := Shell{
+		Command: "cat > /etc/motd",
+		Stdin:   strings.NewReader("hello\n"),
+		Become:  &Become{Password: "secret"},
+	}.Apply(context.Background(), host)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if want := `sudo -S -k -p '' -- sh -c 'cat > /etc/motd'`; runner.cmd != want {
+		t.Errorf("command = %q, want %q", runner.cmd, want)
+	}
+	if got, want := runner.stdin.String(), "secret\nhello\n"; got != want {
+		t.Errorf("stdin = %q, want %q", got, want)
+	}
+}
+
+func TestInstallCommand(t *testing.T) {
+	got := installCommand("/tmp/stage/app.conf", "/etc/app/app.conf", NewPerm(0o600), false)
+	want := `mkdir -p '/etc/app' && cp '/tmp/stage/app.conf' '/etc/app/app.conf' && chmod 600 '/etc/app/app.conf'`
+	if got != want {
+		t.Errorf("installCommand(file) = %q, want %q", got, want)
+	}
+	got = installCommand("/tmp/stage/www", "/srv/www", Perm{}, true)
+	want = `mkdir -p '/srv/www' && cp -R '/tmp/stage/www/.' '/srv/www' && cd '/tmp/stage/www' && ` +
+		`find . -type d -exec sh -c 'for f do chmod 755 "$0/$f" || exit; done' '/srv/www' {} + && ` +
+		`find . -type f -exec sh -c 'for f do chmod 644 "$0/$f" || exit; done' '/srv/www' {} +`
+	if got != want {
+		t.Errorf("installCommand(dir) = %q, want %q", got, want)
+	}
+}
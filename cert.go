@@ -0,0 +1,82 @@
+package iago
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// certificateFiles returns the user certificates to try for identityFile:
+// the given CertificateFiles, followed by identityFile with a "-cert.pub"
+// suffix, which ssh-keygen(1) writes when signing a key, if it exists.
+func certificateFiles(identityFile string, certFiles []string) []string {
+	var files []string
+	for _, file := range certFiles {
+		if file != "" && !slices.Contains(files, expand(file)) {
+			files = append(files, expand(file))
+		}
+	}
+	discovered := expand(identityFile) + "-cert.pub"
+	if _, err := os.Stat(discovered); err == nil && !slices.Contains(files, discovered) {
+		files = append(files, discovered)
+	}
+	return files
+}
+
+// certSigner returns a signer that authenticates with the user certificate in
+// file, using the key among keys that the certificate certifies.
+func certSigner(file string, keys []ssh.Signer, user string, now time.Time) (ssh.Signer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate file %s: %w", file, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("certificate file %s holds a %s key, not a certificate", file, pub.Type())
+	}
+	if err := checkCertificate(cert, user, now); err != nil {
+		return nil, fmt.Errorf("certificate file %s: %w", file, err)
+	}
+	for _, key := range keys {
+		if keysEqual(key.PublicKey(), cert.Key) {
+			signer, err := ssh.NewCertSigner(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("certificate file %s: %w", file, err)
+			}
+			return signer, nil
+		}
+	}
+	return nil, fmt.Errorf("certificate file %s: no private key for %s in the identity file or ssh-agent", file, ssh.FingerprintSHA256(cert.Key))
+}
+
+// checkCertificate returns an error if cert is not a user certificate that
+// lets user log in at time now. A certificate without principals is valid for
+// any user.
+func checkCertificate(cert *ssh.Certificate, user string, now time.Time) error {
+	if cert.CertType != ssh.UserCert {
+		return errors.New("not a user certificate")
+	}
+	unixNow := now.Unix()
+	if after := int64(cert.ValidAfter); after < 0 || unixNow < after {
+		return fmt.Errorf("certificate %q is not valid before %s", cert.KeyId, certTime(cert.ValidAfter))
+	}
+	if before := int64(cert.ValidBefore); cert.ValidBefore != ssh.CertTimeInfinity && (before < 0 || unixNow >= before) {
+		return fmt.Errorf("certificate %q expired at %s", cert.KeyId, certTime(cert.ValidBefore))
+	}
+	if len(cert.ValidPrincipals) > 0 && !slices.Contains(cert.ValidPrincipals, user) {
+		return fmt.Errorf("certificate %q is not valid for user %q, only for %q", cert.KeyId, user, cert.ValidPrincipals)
+	}
+	return nil
+}
+
+func certTime(t uint64) string {
+	return time.Unix(int64(t), 0).UTC().Format(time.RFC3339)
+}
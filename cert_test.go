@@ -0,0 +1,166 @@
+package iago
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeUserCert signs the key in identityFile with ca for principal "test",
+// valid for an hour, applies modify, and writes the certificate to certFile.
+func writeUserCert(t *testing.T, ca ssh.Signer, identityFile, certFile string, modify func(*ssh.Certificate)) {
+	t.Helper()
+	signer, err := loadIdentity(identityFile, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             signer.PublicKey(),
+		KeyId:           "test@example.com",
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"test"},
+		ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+	}
+	if modify != nil {
+		modify(cert)
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, ssh.MarshalAuthorizedKey(cert), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	valid := ssh.Certificate{
+		KeyId:           "alice",
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"alice", "deploy"},
+		ValidAfter:      uint64(now.Add(-time.Hour).Unix()),
+		ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+	}
+	tests := []struct {
+		name    string
+		modify  func(*ssh.Certificate)
+		user    string
+		wantErr string
+	}{
+		{name: "Valid", user: "deploy"},
+		{name: "Forever", user: "alice", modify: func(c *ssh.Certificate) { c.ValidAfter, c.ValidBefore = 0, ssh.CertTimeInfinity }},
+		{name: "AnyPrincipal", user: "root", modify: func(c *ssh.Certificate) { c.ValidPrincipals = nil }},
+		{name: "WrongUser", user: "root", wantErr: `certificate "alice" is not valid for user "root", only for ["alice" "deploy"]`},
+		{name: "Expired", user: "alice", modify: func(c *ssh.Certificate) { c.ValidBefore = uint64(now.Unix()) }, wantErr: `certificate "alice" expired at 2023-11-14T22:13:20Z`},
+		{name: "NotYetValid", user: "alice", modify: func(c *ssh.Certificate) { c.ValidAfter = uint64(now.Add(time.Second).Unix()) }, wantErr: `certificate "alice" is not valid before 2023-11-14T22:13:21Z`},
+		{name: "HostCert", user: "alice", modify: func(c *ssh.Certificate) { c.CertType = ssh.HostCert }, wantErr: "not a user certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := valid
+			if tt.modify != nil {
+				tt.modify(&cert)
+			}
+			err := checkCertificate(&cert, tt.user, now)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkCertificate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("checkCertificate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCertificateFiles(t *testing.T) {
+	dir := t.TempDir()
+	identity := filepath.Join(dir, "id_ed25519")
+	if got := certificateFiles(identity, nil); len(got) != 0 {
+		t.Errorf("certificateFiles() = %q without certificates, want none", got)
+	}
+	if err := os.WriteFile(identity+"-cert.pub", nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	explicit := filepath.Join(dir, "deploy-cert.pub")
+	got := certificateFiles(identity, []string{explicit, explicit, identity + "-cert.pub"})
+	if want := []string{explicit, identity + "-cert.pub"}; !slices.Equal(got, want) {
+		t.Errorf("certificateFiles() = %q, want %q", got, want)
+	}
+}
+
+func TestCertSigner(t *testing.T) {
+	ca := newTestSigner(t)
+	identity := writeIdentity(t)
+	key, err := loadIdentity(identity, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := identity + "-cert.pub"
+	writeUserCert(t, ca, identity, certFile, nil)
+
+	signer, err := certSigner(certFile, []ssh.Signer{key}, "test", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, ok := signer.PublicKey().(*ssh.Certificate); !ok || !keysEqual(cert.Key, key.PublicKey()) {
+		t.Errorf("certSigner() public key = %v, want certificate for the identity", signer.PublicKey())
+	}
+
+	if _, err := certSigner(certFile, nil, "test", time.Now()); err == nil || !strings.Contains(err.Error(), "no private key") {
+		t.Errorf("certSigner() without the key error = %v, want no private key", err)
+	}
+	if _, err := certSigner(certFile, []ssh.Signer{key}, "root", time.Now()); err == nil || !strings.Contains(err.Error(), "certificate file "+certFile) {
+		t.Errorf("certSigner() for another user error = %v, want error naming the file", err)
+	}
+	if err := os.WriteFile(certFile, ssh.MarshalAuthorizedKey(key.PublicKey()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := certSigner(certFile, []ssh.Signer{key}, "test", time.Now()); err == nil || !strings.Contains(err.Error(), "not a certificate") {
+		t.Errorf("certSigner() of a plain public key error = %v, want not a certificate", err)
+	}
+}
+
+func TestNewSSHGroupCertificate(t *testing.T) {
+	ca := newTestSigner(t)
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool { return keysEqual(auth, ca.PublicKey()) },
+	}
+	// The server only accepts certificates signed by the CA.
+	srv := newTestServer(t, &ssh.ServerConfig{PublicKeyCallback: checker.Authenticate})
+
+	discovered := writeIdentity(t)
+	writeUserCert(t, ca, discovered, discovered+"-cert.pub", nil)
+	configured := writeIdentity(t)
+	certFile := filepath.Join(t.TempDir(), "deploy-cert.pub")
+	writeUserCert(t, ca, configured, certFile, nil)
+	expired := writeIdentity(t)
+	writeUserCert(t, ca, expired, expired+"-cert.pub", func(c *ssh.Certificate) {
+		c.ValidBefore = uint64(time.Now().Add(-time.Minute).Unix())
+	})
+
+	file := filepath.Join(t.TempDir(), "config")
+	content := srv.configEntry("discovered", discovered) +
+		srv.configEntry("configured", configured, "CertificateFile "+certFile) +
+		srv.configEntry("expired", expired)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := NewSSHGroup([]string{"discovered", "configured"}, file, FailFast())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = g.Close()
+
+	if _, err := NewSSHGroup([]string{"expired"}, file, FailFast()); err == nil {
+		t.Error("NewSSHGroup() with an expired certificate succeeded")
+	}
+}
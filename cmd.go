@@ -4,8 +4,15 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
 // CmdRunner defines an interface for running commands on remote hosts.
@@ -19,6 +26,10 @@ type CmdRunner interface {
 	StdinPipe() (io.WriteCloser, error)
 	StdoutPipe() (io.ReadCloser, error)
 	StderrPipe() (io.ReadCloser, error)
+
+	// Signal sends sig to the remote process. Only signals defined by the SSH
+	// protocol, such as SIGTERM and SIGKILL, can be sent.
+	Signal(sig os.Signal) error
 }
 
 // Shell runs a shell command.
@@ -27,14 +38,62 @@ type Shell struct {
 	Stdin   io.Reader
 	Stdout  io.Writer
 	Stderr  io.Writer
+
+	// Become, if non-nil, runs the command as another user. See [Become].
+	Become *Become
+
+	// PTY, if non-nil, allocates a pseudo-terminal for the command. See [PTY].
+	PTY *PTY
+
+	// Cancel, if non-nil, terminates the command gracefully when the context
+	// is done. See [CancelPolicy].
+	Cancel *CancelPolicy
 }
 
 // Apply runs the shell command on the host.
 func (sa Shell) Apply(ctx context.Context, host Host) (err error) {
+	sa, err = sa.escalate()
+	if err != nil {
+		return err
+	}
 	cmd, err := host.NewCommand()
 	if err != nil {
 		return err
 	}
+	return sa.run(ctx, host, cmd)
+}
+
+// escalate returns sa with its command and standard input wrapped by
+// sa.Become, if set. sa.Become is kept so that helper commands, such as the
+// kill(1) fallback of a [CancelPolicy], run as the same user.
+func (sa Shell) escalate() (Shell, error) {
+	if sa.Become == nil {
+		return sa, nil
+	}
+	var err error
+	sa.Command, err = sa.Become.command(sa.Command)
+	if err != nil {
+		return sa, err
+	}
+	sa.Stdin = sa.Become.stdin(sa.Stdin)
+	return sa, nil
+}
+
+// run runs sa.Command on cmd, piping its standard streams to and from sa's
+// readers and writers. It must only be called on a Shell returned by
+// [Shell.escalate].
+func (sa Shell) run(ctx context.Context, host Host, cmd CmdRunner) (err error) {
+	if sa.PTY != nil {
+		if err := requestPty(cmd, *sa.PTY); err != nil {
+			closeCmd(cmd)
+			return err
+		}
+		if sa.PTY.Resize != nil {
+			done := make(chan struct{})
+			defer close(done)
+			go forwardResize(cmd, sa.PTY.Resize, done)
+		}
+	}
 
 	goroutines := 0
 	errChan := make(chan error)
@@ -44,6 +103,13 @@ func (sa Shell) Apply(ctx context.Context, host Host) (err error) {
 			// Drain the error channel; nil errors are discarded by Join.
 			err = errors.Join(err, <-errChan)
 		}
+		// Emit output held back by buffering writers, such as a final line
+		// without a trailing newline in a LineWriter.
+		for _, w := range []io.Writer{sa.Stdout, sa.Stderr} {
+			if f, ok := w.(flusher); ok {
+				err = errors.Join(err, f.Flush())
+			}
+		}
 	}()
 
 	if sa.Stdin != nil {
@@ -56,7 +122,22 @@ func (sa Shell) Apply(ctx context.Context, host Host) (err error) {
 		goroutines++
 	}
 
-	if sa.Stdout != nil {
+	var pids chan int
+	if sa.Cancel != nil && sa.Cancel.TrackPID {
+		sa.Command = trackPID(sa.Command)
+		pids = make(chan int, 1)
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		defer safeClose(out, &err, io.EOF)
+		stdout := sa.Stdout
+		if stdout == nil {
+			stdout = io.Discard
+		}
+		go pipePID(stdout, out, pids, errChan)
+		goroutines++
+	} else if sa.Stdout != nil {
 		out, err := cmd.StdoutPipe()
 		if err != nil {
 			return err
@@ -76,7 +157,11 @@ func (sa Shell) Apply(ctx context.Context, host Host) (err error) {
 		goroutines++
 	}
 
-	err = cmd.RunContext(ctx, sa.Command)
+	if sa.Cancel != nil {
+		err = sa.runCancelable(ctx, host, cmd, pids)
+	} else {
+		err = cmd.RunContext(ctx, sa.Command)
+	}
 	if err != nil && err != io.EOF {
 		return err
 	}
@@ -89,6 +174,136 @@ func pipe(dst io.Writer, src io.Reader, errChan chan error) {
 	errChan <- err
 }
 
+// envSetter is implemented by a [CmdRunner] that can set environment
+// variables of the remote command through the SSH protocol, before it starts.
+type envSetter interface {
+	Setenv(name, value string) error
+}
+
+// envNameRE matches a POSIX environment variable name.
+var envNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Command runs a program with arguments on the remote host. Unlike [Shell],
+// which takes a raw command line, Command quotes every argument, so Args are
+// passed to the program verbatim without shell expansion:
+//
+//	iago.Command{
+//		Args: []string{"tar", "xzf", "release.tar.gz"},
+//		Dir:  "/srv/app",
+//		Env:  map[string]string{"LANG": "C"},
+//	}
+//
+// Env is set with the SSH protocol where the server accepts it (see the
+// AcceptEnv option of sshd_config), and through env(1) otherwise. Dir and
+// Args are passed as-is; use [Expand] to expand remote environment variables.
+type Command struct {
+	// Args holds the program and its arguments; it must not be empty.
+	Args []string
+	// Dir is the working directory; empty means the SSH user's home directory.
+	Dir string
+	// Env holds additional environment variables for the program.
+	Env map[string]string
+	// Umask is the file mode creation mask; zero leaves the remote default.
+	Umask fs.FileMode
+	// Timeout, if positive, bounds the run time of the program.
+	Timeout time.Duration
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Become, if non-nil, runs the program as another user. See [Become].
+	Become *Become
+
+	// Cancel, if non-nil, terminates the program gracefully when the context
+	// is done or Timeout expires. See [CancelPolicy].
+	Cancel *CancelPolicy
+}
+
+// Apply runs the command on the host.
+func (c Command) Apply(ctx context.Context, host Host) error {
+	if len(c.Args) == 0 {
+		return errors.New("iago: command has no arguments")
+	}
+	for key := range c.Env {
+		if !envNameRE.MatchString(key) {
+			return fmt.Errorf("iago: invalid environment variable name %q", key)
+		}
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	cmd, err := host.NewCommand()
+	if err != nil {
+		return err
+	}
+	env := c.Env
+	if c.Become == nil {
+		// sudo and doas reset the environment, so only try the protocol
+		// when the program runs as the SSH user.
+		env = setenv(cmd, env)
+	}
+	sa := Shell{
+		Command: c.commandLine(env),
+		Stdin:   c.Stdin,
+		Stdout:  c.Stdout,
+		Stderr:  c.Stderr,
+		Become:  c.Become,
+		Cancel:  c.Cancel,
+	}
+	sa, err = sa.escalate()
+	if err != nil {
+		closeCmd(cmd)
+		return err
+	}
+	return sa.run(ctx, host, cmd)
+}
+
+// setenv sets each variable in env on cmd through the SSH protocol, if cmd
+// supports it, and returns the variables that could not be set that way.
+func setenv(cmd CmdRunner, env map[string]string) map[string]string {
+	setter, ok := cmd.(envSetter)
+	if !ok {
+		return env
+	}
+	var rejected map[string]string
+	for key, val := range env {
+		if err := setter.Setenv(key, val); err != nil {
+			if rejected == nil {
+				rejected = make(map[string]string)
+			}
+			rejected[key] = val
+		}
+	}
+	return rejected
+}
+
+// commandLine returns the POSIX shell command line that runs c.Args in c.Dir
+// with c.Umask, passing env through env(1).
+func (c Command) commandLine(env map[string]string) string {
+	var steps []string
+	if c.Umask != 0 {
+		steps = append(steps, fmt.Sprintf("umask %04o", c.Umask.Perm()))
+	}
+	if c.Dir != "" {
+		steps = append(steps, "cd "+Quote(c.Dir))
+	}
+	args := []string{"exec"}
+	if len(env) > 0 {
+		args = append(args, "env")
+		for _, key := range slices.Sorted(maps.Keys(env)) {
+			args = append(args, Quote(key+"="+env[key]))
+		}
+	}
+	for _, arg := range c.Args {
+		args = append(args, Quote(arg))
+	}
+	return strings.Join(append(steps, strings.Join(args, " ")), " && ")
+}
+
 // Output runs cmd on host as a shell command and returns its captured
 // standard output. It is a convenience wrapper around [Shell] for the common
 // case of wanting a command's output as a string rather than streaming it to
@@ -99,6 +314,88 @@ func Output(ctx context.Context, host Host, cmd string) (string, error) {
 	return buf.String(), err
 }
 
+// CommandResult is the outcome of a command run by [Run].
+type CommandResult struct {
+	Stdout string
+	Stderr string
+	// ExitCode is the command's exit status, or -1 when the command did not
+	// report one, such as when it was interrupted by the context.
+	ExitCode int
+	// Signal is the name of the signal that terminated the command, such as
+	// "KILL", or empty if it exited normally.
+	Signal string
+	// Duration is the time from starting the command until it completed.
+	Duration time.Duration
+	// TimedOut reports whether the command was interrupted because the
+	// context deadline passed before it completed.
+	TimedOut bool
+}
+
+// Success reports whether the command ran to completion and exited zero.
+func (r CommandResult) Success() bool {
+	return r.ExitCode == 0 && r.Signal == "" && !r.TimedOut
+}
+
+// exitSignal is implemented by an [ExitStatus] error that also carries the
+// signal that terminated the remote process, such as *ssh.ExitError.
+type exitSignal interface {
+	Signal() string
+}
+
+// Run runs cmd on host as a shell command and returns its standard output,
+// standard error, exit code and timing in a [CommandResult].
+//
+// A command that runs and exits non-zero, or that times out, is not an error:
+// its outcome is recorded in the result. The error is reserved for failures
+// to run the command at all, such as a dropped connection, and for a context
+// that was cancelled other than by its deadline.
+func Run(ctx context.Context, host Host, cmd string) (CommandResult, error) {
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	err := Shell{Command: cmd, Stdout: &stdout, Stderr: &stderr}.Apply(ctx, host)
+	res := CommandResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+	}
+	// A command that exited, even with a non-zero status, ran to completion
+	// although the deadline may have passed since.
+	if exitErr, ok := errors.AsType[ExitStatus](err); ok {
+		res.ExitCode = exitErr.ExitStatus()
+		if sig, ok := exitErr.(exitSignal); ok {
+			res.Signal = sig.Signal()
+		}
+		return res, nil
+	}
+	switch {
+	case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		// The wait ended because the deadline closed the session.
+		res.TimedOut = true
+		res.ExitCode = -1
+		return res, nil
+	case err != nil && ctx.Err() != nil:
+		res.ExitCode = -1
+		return res, ctx.Err()
+	case err != nil:
+		res.ExitCode = -1
+		return res, err
+	}
+	return res, nil
+}
+
+// RunFunc returns a function that runs cmd with [Run], for use with [Collect]
+// to gather the results of a command from every host in a group:
+//
+//	results, err := iago.Collect(g, "uptime", iago.RunFunc("uptime"))
+//
+// Hosts where the command exits non-zero are included in the results; only
+// hosts where it could not be run are reported in the error.
+func RunFunc(cmd string) func(context.Context, Host) (CommandResult, error) {
+	return func(ctx context.Context, host Host) (CommandResult, error) {
+		return Run(ctx, host, cmd)
+	}
+}
+
 // Quote wraps s in single quotes so it is safe to embed as one argument in a
 // [Shell] command run on a POSIX shell. An embedded single quote is escaped
 // using the `'\''` idiom: end the quoted string, emit an escaped quote, and
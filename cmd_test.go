@@ -4,32 +4,53 @@ import (
 	"context"
 	"errors"
 	"io"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 // fakeCmdRunner is a minimal CmdRunner backing fakeHost.NewCommand in tests
 // that exercise Shell/Output without a real SSH connection. StdoutPipe
 // returns output in full immediately, so it is unsuitable for testing
 // streaming behavior, only the captured-result path Output relies on.
+// RunContext records the command it was given in cmd; stdin, if set, collects
+// what is written to StdinPipe.
 type fakeCmdRunner struct {
 	output string
+	errOut string
 	err    error
+	cmd    string
+	stdin  *strings.Builder
 }
 
-func (r *fakeCmdRunner) Run(string) error                         { return r.err }
-func (r *fakeCmdRunner) RunContext(context.Context, string) error { return r.err }
-func (r *fakeCmdRunner) Start(string) error                       { return r.err }
-func (r *fakeCmdRunner) Wait() error                              { return r.err }
-func (r *fakeCmdRunner) StdinPipe() (io.WriteCloser, error)       { return nil, errors.New("not supported") }
+func (r *fakeCmdRunner) Run(string) error { return r.err }
+func (r *fakeCmdRunner) RunContext(_ context.Context, cmd string) error {
+	r.cmd = cmd
+	return r.err
+}
+func (r *fakeCmdRunner) Start(string) error     { return r.err }
+func (r *fakeCmdRunner) Wait() error            { return r.err }
+func (r *fakeCmdRunner) Signal(os.Signal) error { return nil }
+func (r *fakeCmdRunner) StdinPipe() (io.WriteCloser, error) {
+	if r.stdin == nil {
+		return nil, errors.New("not supported")
+	}
+	return nopWriteCloser{r.stdin}, nil
+}
 func (r *fakeCmdRunner) StdoutPipe() (io.ReadCloser, error) {
 	return io.NopCloser(strings.NewReader(r.output)), nil
 }
 func (r *fakeCmdRunner) StderrPipe() (io.ReadCloser, error) {
-	return io.NopCloser(strings.NewReader("")), nil
+	return io.NopCloser(strings.NewReader(r.errOut)), nil
 }
 
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
 func TestOutputCapturesStdout(t *testing.T) {
 	host := fakeHost{name: "h", cmd: &fakeCmdRunner{output: "hello\n"}}
 	out, err := Output(context.Background(), host, "echo hello")
@@ -72,10 +93,103 @@ func TestQuote(t *testing.T) {
 
 // fakeExitError is a minimal error implementing ExitStatus, standing in for
 // golang.org/x/crypto/ssh's *ssh.ExitError in tests.
-type fakeExitError struct{ status int }
+type fakeExitError struct {
+	status int
+	signal string
+}
 
 func (e fakeExitError) Error() string   { return "exit status " + strconv.Itoa(e.status) }
 func (e fakeExitError) ExitStatus() int { return e.status }
+func (e fakeExitError) Signal() string  { return e.signal }
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		runner      *fakeCmdRunner
+		want        CommandResult
+		wantErr     bool
+		wantSuccess bool
+	}{
+		{
+			name:        "success",
+			runner:      &fakeCmdRunner{output: "out\n", errOut: "warn\n"},
+			want:        CommandResult{Stdout: "out\n", Stderr: "warn\n"},
+			wantSuccess: true,
+		},
+		{
+			name:   "exit status",
+			runner: &fakeCmdRunner{errOut: "no such file\n", err: fakeExitError{status: 2}},
+			want:   CommandResult{Stderr: "no such file\n", ExitCode: 2},
+		},
+		{
+			name:   "signal",
+			runner: &fakeCmdRunner{err: fakeExitError{status: 137, signal: "KILL"}},
+			want:   CommandResult{ExitCode: 137, Signal: "KILL"},
+		},
+		{
+			name:    "transport error",
+			runner:  &fakeCmdRunner{err: errors.New("connection reset")},
+			want:    CommandResult{ExitCode: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := fakeHost{name: "h", cmd: tt.runner}
+			got, err := Run(context.Background(), host, "cmd")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got.Duration = 0
+			if got != tt.want {
+				t.Errorf("Run = %+v, want %+v", got, tt.want)
+			}
+			if got.Success() != tt.wantSuccess {
+				t.Errorf("Success() = %v, want %v", got.Success(), tt.wantSuccess)
+			}
+		})
+	}
+}
+
+func TestRunTimedOut(t *testing.T) {
+	host := newTestServer(t, nil).dial(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res, err := Run(ctx, host, "sleep")
+	if err != nil {
+		t.Fatalf("Run error = %v", err)
+	}
+	if !res.TimedOut || res.ExitCode != -1 || res.Success() {
+		t.Errorf("Run = %+v, want timed out", res)
+	}
+
+	// A command that completed is not reported as timed out, even if the
+	// deadline passed before Run returned.
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	res, err = Run(ctx, fakeHost{name: "h", cmd: &fakeCmdRunner{err: fakeExitError{status: 1}}}, "false")
+	if err != nil || res.TimedOut || res.ExitCode != 1 {
+		t.Errorf("Run = %+v, %v, want exit status 1 without timeout", res, err)
+	}
+}
+
+func TestRunFuncCollect(t *testing.T) {
+	g := NewGroup([]Host{
+		fakeHost{name: "a", cmd: &fakeCmdRunner{output: "ok"}},
+		fakeHost{name: "b", cmd: &fakeCmdRunner{err: fakeExitError{status: 1}}},
+		fakeHost{name: "c", cmd: &fakeCmdRunner{err: errors.New("connection reset")}},
+	})
+	results, err := Collect(g, "task", RunFunc("cmd"))
+	if err == nil {
+		t.Fatal("expected an error from host c, got nil")
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %v, want exactly hosts a and b", results)
+	}
+	if results["b"].ExitCode != 1 {
+		t.Errorf("results[b].ExitCode = %d, want 1", results["b"].ExitCode)
+	}
+}
 
 func TestFileExists(t *testing.T) {
 	tests := []struct {
@@ -113,3 +227,84 @@ func TestDirExists(t *testing.T) {
 		t.Fatal("DirExists = true, want false")
 	}
 }
+
+// fakeEnvRunner is a fakeCmdRunner that accepts the environment variables
+// named in accept through Setenv, like an sshd with an AcceptEnv list.
+type fakeEnvRunner struct {
+	fakeCmdRunner
+	accept []string
+	env    map[string]string
+}
+
+func (r *fakeEnvRunner) Setenv(name, value string) error {
+	if !slices.Contains(r.accept, name) {
+		return errors.New("ssh: setenv failed")
+	}
+	if r.env == nil {
+		r.env = make(map[string]string)
+	}
+	r.env[name] = value
+	return nil
+}
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  Command
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "args",
+			cmd:  Command{Args: []string{"echo", "hello world", "it's"}},
+			want: `exec 'echo' 'hello world' 'it'\''s'`,
+		},
+		{
+			name: "dir and umask",
+			cmd:  Command{Args: []string{"make"}, Dir: "/srv/my app", Umask: 0o027},
+			want: `umask 0027 && cd '/srv/my app' && exec 'make'`,
+		},
+		{
+			name: "env",
+			cmd:  Command{Args: []string{"printenv"}},
+			env:  map[string]string{"B": "2 3", "A": "1"},
+			want: `exec env 'A=1' 'B=2 3' 'printenv'`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cmd.commandLine(tt.env); got != tt.want {
+				t.Errorf("commandLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandEnvFallback(t *testing.T) {
+	runner := &fakeEnvRunner{accept: []string{"LANG"}}
+	host := fakeHost{name: "h", cmd: runner}
+	err := Command{
+		Args: []string{"locale"},
+		Env:  map[string]string{"LANG": "C", "APP_MODE": "test"},
+	}.Apply(context.Background(), host)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if runner.env["LANG"] != "C" {
+		t.Errorf("LANG was not set through Setenv: %v", runner.env)
+	}
+	if want := `exec env 'APP_MODE=test' 'locale'`; runner.cmd != want {
+		t.Errorf("command = %q, want %q", runner.cmd, want)
+	}
+}
+
+func TestCommandInvalid(t *testing.T) {
+	host := fakeHost{name: "h", cmd: &fakeCmdRunner{}}
+	if err := (Command{}).Apply(context.Background(), host); err == nil {
+		t.Error("Apply with no args: got nil error")
+	}
+	err := Command{Args: []string{"true"}, Env: map[string]string{"A B": "x"}}.Apply(context.Background(), host)
+	if err == nil {
+		t.Error("Apply with invalid env name: got nil error")
+	}
+}
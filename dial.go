@@ -0,0 +1,27 @@
+package iago
+
+import (
+	"context"
+	"net"
+)
+
+// Dialer is implemented by a [Host] that can open network connections from
+// the remote machine, such as one dialed by [DialSSH] or [NewSSHGroup].
+// The connections are tunnelled through the host's SSH connection, so they
+// reach services listening on the host's loopback interface, or on machines
+// only the host can reach. A Go HTTP, gRPC or database client can use it in
+// place of [net.Dialer]:
+//
+//	d, ok := host.(iago.Dialer)
+//	if !ok {
+//		return errors.ErrUnsupported
+//	}
+//	client := &http.Client{Transport: &http.Transport{DialContext: d.DialContext}}
+//	resp, err := client.Get("http://localhost:9090/metrics")
+//
+// The network is "tcp", "tcp4" or "tcp6", with host names in addr resolved
+// by the remote machine, or "unix" for a socket path on the remote machine.
+// The connections are closed when the host is closed.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
@@ -0,0 +1,63 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDialer(t *testing.T) {
+	echo := newEchoServer(t)
+	host := newTestServer(t, nil).dial(t)
+	d, ok := host.(Dialer)
+	if !ok {
+		t.Fatalf("%T does not implement Dialer", host)
+	}
+	conn, err := d.DialContext(context.Background(), "tcp", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEcho(t, conn)
+
+	if _, err := d.DialContext(context.Background(), "udp", echo); err == nil {
+		t.Error("DialContext(udp) succeeded, want error")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.DialContext(ctx, "tcp", echo); !errors.Is(err, context.Canceled) {
+		t.Errorf("DialContext() with canceled context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestDialerHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "metrics")
+	}))
+	defer srv.Close()
+	host := newTestServer(t, nil).dial(t)
+	transport := &http.Transport{DialContext: host.(Dialer).DialContext}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "metrics" {
+		t.Errorf("body = %q, want %q", body, "metrics")
+	}
+}
+
+func TestReconnectingHostDialer(t *testing.T) {
+	r := &fakeRedialer{}
+	h := newReconnectingHost(newFakeConnHost("wrk1"), ReconnectPolicy{}, r.redial)
+	if _, err := h.DialContext(context.Background(), "tcp", "localhost:80"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("DialContext() through a host without Dialer error = %v, want %v", err, errors.ErrUnsupported)
+	}
+}
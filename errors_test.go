@@ -10,21 +10,32 @@ import (
 // fakeHost is a no-op Host for exercising Group.Run without a real
 // connection. Name is used to label task errors; cmd, if set, backs
 // NewCommand for tests that exercise Shell/Output; fsys, if set, backs GetFS
-// for tests that exercise Upload/UploadFile.
+// for tests that exercise Upload/UploadFile; vars, if set, backs SetVar and
+// GetVar; env backs GetEnv.
 type fakeHost struct {
 	name string
 	cmd  CmdRunner
 	fsys fs.FS
+	vars map[string]any
+	env  map[string]string
 }
 
 func (h fakeHost) Name() string                   { return h.name }
 func (h fakeHost) Address() string                { return h.name }
-func (h fakeHost) GetEnv(string) string           { return "" }
+func (h fakeHost) GetEnv(key string) string       { return h.env[key] }
 func (h fakeHost) GetFS() fs.FS                   { return h.fsys }
 func (h fakeHost) NewCommand() (CmdRunner, error) { return h.cmd, nil }
 func (h fakeHost) Close() error                   { return nil }
-func (h fakeHost) SetVar(string, any)             {}
-func (h fakeHost) GetVar(string) (any, bool)      { return nil, false }
+func (h fakeHost) SetVar(key string, val any) {
+	if h.vars != nil {
+		h.vars[key] = val
+	}
+}
+
+func (h fakeHost) GetVar(key string) (any, bool) {
+	val, ok := h.vars[key]
+	return val, ok
+}
 
 func TestErrorsCollector(t *testing.T) {
 	var errs Errors
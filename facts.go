@@ -0,0 +1,267 @@
+package iago
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"text/template"
+
+	fs "github.com/relab/wrfs"
+)
+
+// factsVar is the host variable in which [GatherFacts] caches the facts.
+const factsVar = "iago.facts"
+
+// Facts describes the operating system and hardware of a host.
+type Facts struct {
+	// Hostname is the host name reported by the host itself, which may differ
+	// from the name used to connect to it.
+	Hostname string
+	// OS is the ID of the distribution from os-release(5), such as "debian".
+	OS string
+	// OSVersion is the VERSION_ID from os-release(5), such as "12".
+	OSVersion string
+	// OSName is the PRETTY_NAME from os-release(5), such as
+	// "Debian GNU/Linux 12 (bookworm)".
+	OSName string
+	// Kernel is the kernel release, as printed by uname -r.
+	Kernel string
+	// Arch is the machine hardware name, as printed by uname -m, such as
+	// "x86_64" or "aarch64".
+	Arch string
+	// CPUs is the number of processors available.
+	CPUs int
+	// MemTotal and MemAvailable are the total and available memory in bytes.
+	MemTotal, MemAvailable uint64
+	// Filesystems lists the mounted file systems.
+	Filesystems []Filesystem
+	// Addresses lists the IP addresses of the network interfaces.
+	Addresses []InterfaceAddr
+	// PackageManager is the detected package manager, or empty if unknown.
+	PackageManager PackageManager
+}
+
+// Filesystem describes a mounted file system. Sizes are in bytes.
+type Filesystem struct {
+	Device     string
+	MountPoint string
+	Size       uint64
+	Used       uint64
+	Available  uint64
+}
+
+// InterfaceAddr is an IP address assigned to a network interface.
+type InterfaceAddr struct {
+	Interface string
+	Prefix    netip.Prefix
+}
+
+// GlobalAddrs returns the addresses of the host that are neither loopback nor
+// link-local, which are usually the ones other hosts can reach it on.
+func (f Facts) GlobalAddrs() []netip.Addr {
+	var addrs []netip.Addr
+	for _, a := range f.Addresses {
+		addr := a.Prefix.Addr()
+		if addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// Filesystem returns the file system mounted at mountPoint, if any.
+func (f Facts) Filesystem(mountPoint string) (Filesystem, bool) {
+	for _, fsys := range f.Filesystems {
+		if fsys.MountPoint == mountPoint {
+			return fsys, true
+		}
+	}
+	return Filesystem{}, false
+}
+
+// factsScript prints the facts that cannot be read from files, in sections
+// parsed by parseFactsOutput. Commands that are missing on a host leave their
+// section empty rather than failing the script.
+const factsScript = `uname -n; uname -r; uname -m
+nproc 2>/dev/null || echo 0
+echo '--- df'
+df -P -k 2>/dev/null
+echo '--- ip'
+ip -o addr show 2>/dev/null
+exit 0`
+
+// GetFacts returns the facts of host, gathering them with [GatherFacts] the
+// first time and returning the cached facts afterwards.
+func GetFacts(ctx context.Context, host Host) (Facts, error) {
+	if val, ok := host.GetVar(factsVar); ok {
+		if facts, ok := val.(Facts); ok {
+			return facts, nil
+		}
+	}
+	return GatherFacts(ctx, host)
+}
+
+// GatherFacts gathers the facts of host and caches them in the host's
+// variables, replacing any facts gathered earlier. Use it instead of
+// [GetFacts] after a task has changed the host, such as by mounting a disk.
+func GatherFacts(ctx context.Context, host Host) (Facts, error) {
+	out, err := Output(ctx, host, factsScript)
+	if err != nil {
+		return Facts{}, fmt.Errorf("iago: failed to gather facts: %w", err)
+	}
+	facts, err := parseFactsOutput(out)
+	if err != nil {
+		return Facts{}, err
+	}
+
+	fsys := host.GetFS()
+	if release, err := readOSRelease(host); err == nil {
+		facts.OS = release["ID"]
+		facts.OSVersion = release["VERSION_ID"]
+		facts.OSName = release["PRETTY_NAME"]
+	}
+	if data, err := fs.ReadFile(fsys, "proc/meminfo"); err == nil {
+		facts.MemTotal, facts.MemAvailable = parseMeminfo(string(data))
+	}
+	if facts.CPUs == 0 {
+		if data, err := fs.ReadFile(fsys, "proc/cpuinfo"); err == nil {
+			facts.CPUs = countProcessors(string(data))
+		}
+	}
+	if pm, err := DetectPackageManager(host); err == nil {
+		facts.PackageManager = pm
+	}
+	host.SetVar(factsVar, facts)
+	return facts, nil
+}
+
+// CollectFacts gathers the facts of every host in g concurrently, for example
+// to report on an inventory. Facts already cached on a host are reused.
+func CollectFacts(g Group) (map[string]Facts, error) {
+	return Collect(g, "Gather facts", GetFacts)
+}
+
+// TemplateFuncs returns template functions that query host, for use with
+// [text/template.Template.Funcs]. The "facts" function returns the facts of
+// host, as in {{(facts).CPUs}}. [UnitFile] templates can use them directly.
+func TemplateFuncs(ctx context.Context, host Host) template.FuncMap {
+	return template.FuncMap{
+		"facts": func() (Facts, error) { return GetFacts(ctx, host) },
+	}
+}
+
+// parseFactsOutput parses the output of factsScript.
+func parseFactsOutput(out string) (facts Facts, err error) {
+	section := ""
+	header := 0
+	for line := range strings.Lines(out) {
+		line = strings.TrimRight(line, "\r\n")
+		if name, ok := strings.CutPrefix(line, "--- "); ok {
+			section = name
+			continue
+		}
+		switch section {
+		case "":
+			switch header {
+			case 0:
+				facts.Hostname = line
+			case 1:
+				facts.Kernel = line
+			case 2:
+				facts.Arch = line
+			case 3:
+				facts.CPUs, _ = strconv.Atoi(strings.TrimSpace(line))
+			}
+			header++
+		case "df":
+			if fsys, ok := parseDfLine(line); ok {
+				facts.Filesystems = append(facts.Filesystems, fsys)
+			}
+		case "ip":
+			if addr, ok := parseIPAddrLine(line); ok {
+				facts.Addresses = append(facts.Addresses, addr)
+			}
+		}
+	}
+	if header < 3 {
+		return Facts{}, fmt.Errorf("iago: unexpected facts output %q", out)
+	}
+	return facts, nil
+}
+
+// parseDfLine parses a line of df -P -k output, skipping the header.
+func parseDfLine(line string) (Filesystem, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 6 {
+		return Filesystem{}, false
+	}
+	size, err1 := strconv.ParseUint(fields[1], 10, 64)
+	used, err2 := strconv.ParseUint(fields[2], 10, 64)
+	avail, err3 := strconv.ParseUint(fields[3], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return Filesystem{}, false
+	}
+	return Filesystem{
+		Device:     fields[0],
+		MountPoint: strings.Join(fields[5:], " "),
+		Size:       size * 1024,
+		Used:       used * 1024,
+		Available:  avail * 1024,
+	}, true
+}
+
+// parseIPAddrLine parses a line of ip -o addr show output, such as
+//
+//	2: eth0    inet 172.17.0.2/16 brd 172.17.255.255 scope global eth0
+func parseIPAddrLine(line string) (InterfaceAddr, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+		return InterfaceAddr{}, false
+	}
+	prefix, err := netip.ParsePrefix(fields[3])
+	if err != nil {
+		return InterfaceAddr{}, false
+	}
+	name, _, _ := strings.Cut(fields[1], "@")
+	return InterfaceAddr{Interface: name, Prefix: prefix}, true
+}
+
+// parseMeminfo returns the total and available memory in bytes from the
+// contents of /proc/meminfo.
+func parseMeminfo(data string) (total, available uint64) {
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+	return total, available
+}
+
+// countProcessors returns the number of processors listed in the contents of
+// /proc/cpuinfo.
+func countProcessors(data string) int {
+	n := 0
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		if key, _, ok := strings.Cut(sc.Text(), ":"); ok && strings.TrimSpace(key) == "processor" {
+			n++
+		}
+	}
+	return n
+}
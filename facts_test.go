@@ -0,0 +1,120 @@
+package iago
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relab/wrfs"
+)
+
+const factsOutput = `wrk1
+6.1.0-18-amd64
+x86_64
+0
+--- df
+Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sda1         61665068 20000000  38502364      35% /
+tmpfs              8159208        0   8159208       0% /mnt/my disk
+--- ip
+1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+1: lo    inet6 ::1/128 scope host \       valid_lft forever preferred_lft forever
+2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0\       valid_lft forever preferred_lft forever
+2: eth0    inet6 fe80::1/64 scope link \       valid_lft forever preferred_lft forever
+`
+
+// factsHost returns a fakeHost whose file system holds the given files and
+// whose commands print out.
+func factsHost(t *testing.T, files map[string]string, out string) fakeHost {
+	t.Helper()
+	root := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fakeHost{name: "wrk1", cmd: &fakeCmdRunner{output: out, stdin: &strings.Builder{}}, fsys: wrfs.DirFS(root), vars: map[string]any{}}
+}
+
+func TestGatherFacts(t *testing.T) {
+	host := factsHost(t, map[string]string{
+		"etc/os-release": "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\nVERSION_ID=\"12\"\n",
+		"proc/meminfo":   "MemTotal:       16318420 kB\nMemFree:         1000000 kB\nMemAvailable:    8000000 kB\n",
+		"proc/cpuinfo":   "processor\t: 0\nmodel name\t: x\n\nprocessor\t: 1\nmodel name\t: x\n",
+	}, factsOutput)
+
+	facts, err := GatherFacts(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if facts.Hostname != "wrk1" || facts.Kernel != "6.1.0-18-amd64" || facts.Arch != "x86_64" {
+		t.Errorf("uname facts = %q, %q, %q", facts.Hostname, facts.Kernel, facts.Arch)
+	}
+	if facts.OS != "debian" || facts.OSVersion != "12" || facts.OSName != "Debian GNU/Linux 12 (bookworm)" || facts.PackageManager != Apt {
+		t.Errorf("OS facts = %q, %q, %q, %q", facts.OS, facts.OSVersion, facts.OSName, facts.PackageManager)
+	}
+	if facts.CPUs != 2 {
+		t.Errorf("CPUs = %d, want 2 from /proc/cpuinfo", facts.CPUs)
+	}
+	if facts.MemTotal != 16318420*1024 || facts.MemAvailable != 8000000*1024 {
+		t.Errorf("memory = %d, %d", facts.MemTotal, facts.MemAvailable)
+	}
+	root, ok := facts.Filesystem("/")
+	if !ok || root.Device != "/dev/sda1" || root.Size != 61665068*1024 || root.Available != 38502364*1024 {
+		t.Errorf("Filesystem(\"/\") = %+v, %t", root, ok)
+	}
+	if _, ok := facts.Filesystem("/mnt/my disk"); !ok {
+		t.Errorf("Filesystem(\"/mnt/my disk\") not found in %+v", facts.Filesystems)
+	}
+	if len(facts.Addresses) != 4 || facts.Addresses[2].Interface != "eth0" {
+		t.Errorf("Addresses = %+v", facts.Addresses)
+	}
+	if got, want := facts.GlobalAddrs(), []netip.Addr{netip.MustParseAddr("10.0.0.5")}; !slices.Equal(got, want) {
+		t.Errorf("GlobalAddrs() = %v, want %v", got, want)
+	}
+}
+
+func TestGetFactsCached(t *testing.T) {
+	host := factsHost(t, nil, "wrk1\n6.1\nx86_64\n4\n")
+	first, err := GetFacts(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.CPUs != 4 || first.PackageManager != "" {
+		t.Errorf("GetFacts() = %+v, want 4 CPUs and no package manager", first)
+	}
+	host.cmd.(*fakeCmdRunner).output = "wrk1\n6.1\nx86_64\n8\n"
+	if cached, err := GetFacts(context.Background(), host); err != nil || cached.CPUs != 4 {
+		t.Errorf("GetFacts() = %d CPUs, %v, want cached 4", cached.CPUs, err)
+	}
+	if fresh, err := GatherFacts(context.Background(), host); err != nil || fresh.CPUs != 8 {
+		t.Errorf("GatherFacts() = %d CPUs, %v, want 8", fresh.CPUs, err)
+	}
+}
+
+func TestGatherFactsUnexpectedOutput(t *testing.T) {
+	host := factsHost(t, nil, "wrk1\n")
+	if _, err := GatherFacts(context.Background(), host); err == nil {
+		t.Error("GatherFacts() with truncated output succeeded, want error")
+	}
+}
+
+func TestUnitFileFacts(t *testing.T) {
+	host := factsHost(t, nil, "")
+	host.vars[factsVar] = Facts{CPUs: 16}
+	unit := UnitFile{Name: "replica.service", Template: "[Service]\nExecStart=/opt/replica --threads {{(facts).CPUs}}\n"}
+	if _, err := unit.Install(context.Background(), host); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := host.cmd.(*fakeCmdRunner).stdin.String(), "[Service]\nExecStart=/opt/replica --threads 16\n"; got != want {
+		t.Errorf("Install() wrote %q, want %q", got, want)
+	}
+}
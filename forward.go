@@ -0,0 +1,457 @@
+package iago
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrForwardUnsupported is returned when forwarding ports through a host that
+// does not support it.
+var ErrForwardUnsupported = errors.New("port forwarding not supported")
+
+// portForwarder is implemented by a [Host] that can forward ports, such as
+// one dialed by [DialSSH] or [NewSSHGroup].
+type portForwarder interface {
+	Dialer
+	// listenRemote listens on addr on the remote host.
+	listenRemote(addr string) (net.Listener, error)
+	// forwardSet returns the forwards closed with the host.
+	forwardSet() *forwardSet
+}
+
+// Forward is a port forward started by [LocalForward], [RemoteForward] or
+// [DynamicForward]. It is closed when its host is closed, or by Close.
+type Forward struct {
+	host    string
+	ln      net.Listener
+	connect func(net.Conn) (io.ReadWriteCloser, error) // connects an accepted connection to its destination
+	onError func(error)                                // if non-nil, reports connections that could not be forwarded
+	set     *forwardSet
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	conns   map[io.Closer]struct{} // accepted and dialed connections
+	closed  bool
+	once    sync.Once
+}
+
+// LocalForward listens on localAddr on this machine and forwards each
+// connection to remoteAddr, which is resolved and dialed by host, like
+// ssh -L. For example, to reach Prometheus listening on the loopback
+// interface of host:
+//
+//	fwd, err := iago.LocalForward(host, "localhost:0", "localhost:9090")
+//	// http://<fwd.Addr()>/metrics
+//
+// A port of 0 in localAddr picks a free port, which [Forward.Addr] reports.
+// A connection that cannot be forwarded is closed.
+func LocalForward(host Host, localAddr, remoteAddr string) (*Forward, error) {
+	return localForward(host, localAddr, remoteAddr, nil)
+}
+
+// localForward is [LocalForward], reporting connections that could not be
+// forwarded to onError.
+func localForward(host Host, localAddr, remoteAddr string, onError func(error)) (*Forward, error) {
+	pf, ok := host.(portForwarder)
+	if !ok {
+		return nil, fmt.Errorf("iago: %s: %w", host.Name(), ErrForwardUnsupported)
+	}
+	ln, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("iago: %s: local forward: %w", host.Name(), err)
+	}
+	return startForward(host.Name(), pf.forwardSet(), ln, func(net.Conn) (io.ReadWriteCloser, error) {
+		return pf.DialContext(context.Background(), "tcp", remoteAddr)
+	}, onError)
+}
+
+// RemoteForward asks host to listen on remoteAddr and forwards each
+// connection it accepts to localAddr, dialed from this machine, like ssh -R.
+// For example, to serve artifacts from a local server to host:
+//
+//	fwd, err := iago.RemoteForward(host, "localhost:8000", "localhost:8080")
+//
+// Whether remoteAddr may bind other interfaces than the loopback interface
+// depends on the GatewayPorts setting of the SSH server. A port of 0 lets the
+// server pick one, which [Forward.Addr] reports. A remote forward does not
+// survive a reconnect (see [Reconnect]).
+func RemoteForward(host Host, remoteAddr, localAddr string) (*Forward, error) {
+	return remoteForward(host, remoteAddr, localAddr, nil)
+}
+
+// remoteForward is [RemoteForward], reporting connections that could not be
+// forwarded to onError.
+func remoteForward(host Host, remoteAddr, localAddr string, onError func(error)) (*Forward, error) {
+	pf, ok := host.(portForwarder)
+	if !ok {
+		return nil, fmt.Errorf("iago: %s: %w", host.Name(), ErrForwardUnsupported)
+	}
+	ln, err := pf.listenRemote(remoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("iago: %s: remote forward: %w", host.Name(), err)
+	}
+	return startForward(host.Name(), pf.forwardSet(), ln, func(net.Conn) (io.ReadWriteCloser, error) {
+		return net.Dial("tcp", localAddr)
+	}, onError)
+}
+
+// DynamicForward runs a SOCKS5 proxy on localAddr on this machine, which
+// connects to the requested destinations from host, like ssh -D. Clients
+// must not require authentication, and host names are resolved by host.
+func DynamicForward(host Host, localAddr string) (*Forward, error) {
+	return dynamicForward(host, localAddr, nil)
+}
+
+// dynamicForward is [DynamicForward], reporting connections that could not be
+// forwarded to onError.
+func dynamicForward(host Host, localAddr string, onError func(error)) (*Forward, error) {
+	pf, ok := host.(portForwarder)
+	if !ok {
+		return nil, fmt.Errorf("iago: %s: %w", host.Name(), ErrForwardUnsupported)
+	}
+	ln, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, fmt.Errorf("iago: %s: dynamic forward: %w", host.Name(), err)
+	}
+	return startForward(host.Name(), pf.forwardSet(), ln, func(conn net.Conn) (io.ReadWriteCloser, error) {
+		return serveSOCKS5(conn, pf)
+	}, onError)
+}
+
+// startForward registers a forward in set that accepts connections on ln and
+// relays each to the connection returned by connect, reporting the errors of
+// connect to onError if it is non-nil.
+func startForward(host string, set *forwardSet, ln net.Listener, connect func(net.Conn) (io.ReadWriteCloser, error), onError func(error)) (*Forward, error) {
+	f := &Forward{host: host, ln: ln, connect: connect, onError: onError, set: set, conns: make(map[io.Closer]struct{})}
+	if err := set.add(f); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("iago: %s: %w", host, err)
+	}
+	f.wg.Go(f.serve)
+	return f, nil
+}
+
+// Addr returns the address the forward listens on: on this machine for a
+// local or dynamic forward, and on the remote host for a remote forward.
+func (f *Forward) Addr() net.Addr {
+	return f.ln.Addr()
+}
+
+// Close stops listening and closes the forwarded connections.
+func (f *Forward) Close() error {
+	var err error
+	f.once.Do(func() {
+		f.set.remove(f)
+		err = f.ln.Close()
+		f.mu.Lock()
+		f.closed = true
+		for conn := range f.conns {
+			_ = conn.Close()
+		}
+		f.mu.Unlock()
+		f.wg.Wait()
+	})
+	return err
+}
+
+func (f *Forward) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		if !f.track(conn) {
+			_ = conn.Close()
+			return
+		}
+		f.wg.Go(func() {
+			defer f.untrack(conn)
+			peer, err := f.connect(conn)
+			if err != nil {
+				if f.onError != nil {
+					f.onError(fmt.Errorf("iago: %s: forward from %s: %w", f.host, f.ln.Addr(), err))
+				}
+				return
+			}
+			if !f.track(peer) {
+				_ = peer.Close()
+				return
+			}
+			defer f.untrack(peer)
+			relay(conn, peer)
+		})
+	}
+}
+
+func (f *Forward) track(conn io.Closer) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *Forward) untrack(conn io.Closer) {
+	_ = conn.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn)
+}
+
+// forwardSet holds the forwards of a host, so that they are closed with it.
+// Its zero value is ready to use.
+type forwardSet struct {
+	mu       sync.Mutex
+	forwards map[*Forward]struct{}
+	closed   bool
+}
+
+func (s *forwardSet) add(f *Forward) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrHostClosed
+	}
+	if s.forwards == nil {
+		s.forwards = make(map[*Forward]struct{})
+	}
+	s.forwards[f] = struct{}{}
+	return nil
+}
+
+func (s *forwardSet) remove(f *Forward) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.forwards, f)
+}
+
+// close closes every forward and prevents new ones from being added.
+func (s *forwardSet) close() error {
+	s.mu.Lock()
+	s.closed = true
+	forwards := make([]*Forward, 0, len(s.forwards))
+	for f := range s.forwards {
+		forwards = append(forwards, f)
+	}
+	s.mu.Unlock()
+	var errs []error
+	for _, f := range forwards {
+		if err := f.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// relay copies data between a and b in both directions, closing the writing
+// side of each when the other reaches EOF, and closes both when done.
+func relay(a, b io.ReadWriteCloser) {
+	var wg sync.WaitGroup
+	wg.Go(func() { _, _ = io.Copy(a, b); closeWrite(a) })
+	wg.Go(func() { _, _ = io.Copy(b, a); closeWrite(b) })
+	wg.Wait()
+	_ = a.Close()
+	_ = b.Close()
+}
+
+// closeWrite closes the writing side of c, or all of c if it cannot be
+// closed for writing only.
+func closeWrite(c io.Closer) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+		return
+	}
+	_ = c.Close()
+}
+
+// serveSOCKS5 serves a SOCKS5 CONNECT request without authentication on
+// conn, and returns the connection to the destination, dialed through pf.
+func serveSOCKS5(conn net.Conn, pf portForwarder) (io.ReadWriteCloser, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return nil, err
+	}
+	if head[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported SOCKS version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(methods, socks5AuthNone) {
+		_, _ = conn.Write([]byte{socks5Version, socks5AuthNoAccept})
+		return nil, errors.New("SOCKS client requires authentication")
+	}
+	if _, err := conn.Write([]byte{socks5Version, socks5AuthNone}); err != nil {
+		return nil, err
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return nil, err
+	}
+	reply := func(code byte) error {
+		_, err := conn.Write([]byte{socks5Version, code, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+		return err
+	}
+	if req[1] != socks5CmdConnect {
+		_ = reply(7) // command not supported
+		return nil, fmt.Errorf("unsupported SOCKS command %d", req[1])
+	}
+	var host string
+	switch req[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if req[3] == socks5AddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = ip.String()
+	case socks5AddrDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return nil, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		_ = reply(8) // address type not supported
+		return nil, fmt.Errorf("unsupported SOCKS address type %d", req[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+
+	remote, err := pf.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		_ = reply(4) // host unreachable
+		return nil, err
+	}
+	if err := reply(0); err != nil {
+		_ = remote.Close()
+		return nil, err
+	}
+	return remote, nil
+}
+
+// startForwards starts the forwards given for alias by the LocalForward,
+// RemoteForward and DynamicForward directives of the SSH config on host. A
+// forward that fails to start, or later fails to forward a connection, is
+// reported with warn, unless ExitOnForwardFailure is set, in which case a
+// forward that fails to start is returned as the error.
+func (cw *sshConfig) startForwards(alias string, host Host) error {
+	exitOnFailure, err := cw.get(alias, "ExitOnForwardFailure")
+	if err != nil {
+		return err
+	}
+	start := func(keyword string, fn func(spec string) error) error {
+		specs, err := cw.config.GetAll(alias, keyword)
+		if err != nil {
+			return fmt.Errorf("iago: failed to get %s for %s: %w", keyword, alias, err)
+		}
+		for _, spec := range specs {
+			err := fn(spec)
+			var parseErr forwardSpecError
+			switch {
+			case err == nil:
+			case errors.As(err, &parseErr):
+				return fmt.Errorf("iago: invalid %s %q for %s: %w", keyword, spec, alias, err)
+			case strings.EqualFold(exitOnFailure, "yes"):
+				return err
+			default:
+				cw.warn(err)
+			}
+		}
+		return nil
+	}
+	if err := start("LocalForward", func(spec string) error {
+		listen, target, err := parseForwardSpec(spec)
+		if err != nil {
+			return err
+		}
+		_, err = localForward(host, listen, target, cw.warn)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := start("RemoteForward", func(spec string) error {
+		listen, target, err := parseForwardSpec(spec)
+		if err != nil {
+			return err
+		}
+		_, err = remoteForward(host, listen, target, cw.warn)
+		return err
+	}); err != nil {
+		return err
+	}
+	return start("DynamicForward", func(spec string) error {
+		listen, err := forwardListenAddr(strings.TrimSpace(spec))
+		if err != nil {
+			return err
+		}
+		_, err = dynamicForward(host, listen, cw.warn)
+		return err
+	})
+}
+
+// forwardSpecError is returned for an invalid forwarding directive.
+type forwardSpecError string
+
+func (e forwardSpecError) Error() string { return string(e) }
+
+// parseForwardSpec parses the value of a LocalForward or RemoteForward
+// directive, "[bind_address:]port host:hostport", into the address to listen
+// on and the address to connect to.
+func parseForwardSpec(spec string) (listen, target string, err error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return "", "", forwardSpecError("want [bind_address:]port host:hostport")
+	}
+	if listen, err = forwardListenAddr(fields[0]); err != nil {
+		return "", "", err
+	}
+	host, port, err := net.SplitHostPort(fields[1])
+	if err != nil || host == "" {
+		return "", "", forwardSpecError(fmt.Sprintf("invalid destination %q", fields[1]))
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", "", forwardSpecError(fmt.Sprintf("invalid destination port %q", port))
+	}
+	return listen, fields[1], nil
+}
+
+// forwardListenAddr returns the address to listen on for "[bind_address:]port".
+// As with OpenSSH, a missing bind address means the loopback interface, and
+// an empty one or "*" means every interface.
+func forwardListenAddr(spec string) (string, error) {
+	host, port := "localhost", spec
+	if strings.Contains(spec, ":") {
+		var err error
+		if host, port, err = net.SplitHostPort(spec); err != nil {
+			return "", forwardSpecError(fmt.Sprintf("invalid listen address %q", spec))
+		}
+		if host == "*" {
+			host = ""
+		}
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", forwardSpecError(fmt.Sprintf("invalid listen port %q", port))
+	}
+	return net.JoinHostPort(host, port), nil
+}
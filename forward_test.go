@@ -0,0 +1,229 @@
+package iago
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkEcho checks that conn reaches a server started by newEchoServer.
+func checkEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("hello\nping\n"))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello\nping\n" {
+		t.Errorf("read %q through forward, want greeting and echo", buf)
+	}
+}
+
+func TestLocalForward(t *testing.T) {
+	echo := newEchoServer(t)
+	host := newTestServer(t, nil).dial(t)
+	fwd, err := LocalForward(host, "127.0.0.1:0", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwd.Close()
+	for range 2 {
+		conn, err := net.Dial("tcp", fwd.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkEcho(t, conn)
+	}
+}
+
+func TestRemoteForward(t *testing.T) {
+	echo := newEchoServer(t)
+	host := newTestServer(t, nil).dial(t)
+	fwd, err := RemoteForward(host, "127.0.0.1:0", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwd.Close()
+	// The test server listens on this machine, so the remote address can be
+	// dialed directly.
+	conn, err := net.Dial("tcp", fwd.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEcho(t, conn)
+}
+
+func TestDynamicForward(t *testing.T) {
+	echo := newEchoServer(t)
+	host := newTestServer(t, nil).dial(t)
+	fwd, err := DynamicForward(host, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwd.Close()
+	_, port, _ := net.SplitHostPort(echo)
+	proxy := &url.URL{Scheme: "socks5h", Host: fwd.Addr().String()}
+	conn, err := dialProxy(proxy, net.JoinHostPort("localhost", port), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEcho(t, conn)
+
+	// A destination the remote host cannot reach is refused.
+	if _, err := dialProxy(proxy, unusedAddr(t), 5*time.Second); err == nil {
+		t.Error("dialProxy() to a closed port succeeded")
+	}
+}
+
+func TestForwardClosedWithHost(t *testing.T) {
+	echo := newEchoServer(t)
+	host := newTestServer(t, nil).dial(t)
+	fwd, err := LocalForward(host, "127.0.0.1:0", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", fwd.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := host.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := net.Dial("tcp", fwd.Addr().String()); err == nil {
+		c.Close()
+		t.Error("forward still listening after the host was closed")
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Errorf("forwarded connection was not closed with the host: %v", err)
+	}
+	if _, err := LocalForward(host, "127.0.0.1:0", echo); !errors.Is(err, ErrHostClosed) {
+		t.Errorf("LocalForward() on closed host error = %v, want %v", err, ErrHostClosed)
+	}
+	if err := fwd.Close(); err != nil {
+		t.Errorf("Close() after host was closed error = %v", err)
+	}
+}
+
+func TestForwardUnsupported(t *testing.T) {
+	host := &fakeHost{name: "fake"}
+	if _, err := LocalForward(host, "127.0.0.1:0", "localhost:80"); !errors.Is(err, ErrForwardUnsupported) {
+		t.Errorf("LocalForward() error = %v, want %v", err, ErrForwardUnsupported)
+	}
+	if _, err := RemoteForward(host, "localhost:0", "localhost:80"); !errors.Is(err, ErrForwardUnsupported) {
+		t.Errorf("RemoteForward() error = %v, want %v", err, ErrForwardUnsupported)
+	}
+	if _, err := DynamicForward(host, "127.0.0.1:0"); !errors.Is(err, ErrForwardUnsupported) {
+		t.Errorf("DynamicForward() error = %v, want %v", err, ErrForwardUnsupported)
+	}
+}
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantListen string
+		wantTarget string
+		wantErr    bool
+	}{
+		{spec: "9090 localhost:9090", wantListen: "localhost:9090", wantTarget: "localhost:9090"},
+		{spec: "127.0.0.1:8080 wrk1:80", wantListen: "127.0.0.1:8080", wantTarget: "wrk1:80"},
+		{spec: "*:8080 wrk1:80", wantListen: ":8080", wantTarget: "wrk1:80"},
+		{spec: ":8080 wrk1:80", wantListen: ":8080", wantTarget: "wrk1:80"},
+		{spec: "[::1]:8080 [fd00::1]:80", wantListen: "[::1]:8080", wantTarget: "[fd00::1]:80"},
+		{spec: "8080", wantErr: true},
+		{spec: "http wrk1:80", wantErr: true},
+		{spec: "8080 wrk1", wantErr: true},
+		{spec: "8080 wrk1:http", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			listen, target, err := parseForwardSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseForwardSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if listen != tt.wantListen || target != tt.wantTarget {
+				t.Errorf("parseForwardSpec(%q) = %q, %q, want %q, %q", tt.spec, listen, target, tt.wantListen, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestConfigForwards(t *testing.T) {
+	echo := newEchoServer(t)
+	srv := newTestServer(t, nil)
+	identity := writeIdentity(t)
+	localPort := unusedPort(t)
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	file := filepath.Join(t.TempDir(), "config")
+	content := srv.configEntry("fwd", identity, "LocalForward 127.0.0.1:"+localPort+" "+echo) + "\n" +
+		srv.configEntry("busy", identity, "LocalForward "+busy.Addr().String()+" "+echo) + "\n" +
+		srv.configEntry("busy-exit", identity, "LocalForward "+busy.Addr().String()+" "+echo, "ExitOnForwardFailure yes") + "\n" +
+		srv.configEntry("invalid", identity, "LocalForward 8080")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var errs Errors
+	g, err := NewSSHGroup([]string{"fwd", "busy", "busy-exit", "invalid"}, file, WithErrorHandler(errs.Handle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The forward of busy failed to start without failing the dial.
+	if err := errs.Err(); err == nil || !strings.Contains(err.Error(), "busy: local forward") {
+		t.Errorf("ErrorHandler got %v, want the failed forward of busy", err)
+	}
+	conn, err := net.Dial("tcp", "127.0.0.1:"+localPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEcho(t, conn)
+	if len(g.Hosts) != 2 {
+		t.Errorf("group has %d hosts, want fwd and busy", len(g.Hosts))
+	}
+	if g.DialErrors["busy-exit"] == nil || g.DialErrors["invalid"] == nil {
+		t.Errorf("DialErrors = %v, want errors for busy-exit and invalid", g.DialErrors)
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := net.Dial("tcp", "127.0.0.1:"+localPort); err == nil {
+		c.Close()
+		t.Error("configured forward still listening after the group was closed")
+	}
+}
+
+// unusedPort returns a local TCP port that was free when it was checked.
+func unusedPort(t *testing.T) string {
+	t.Helper()
+	_, port, _ := net.SplitHostPort(unusedAddr(t))
+	return port
+}
+
+// unusedAddr returns a local TCP address that was free when it was checked.
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
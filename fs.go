@@ -9,6 +9,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	fs "github.com/relab/wrfs"
 )
@@ -115,10 +116,18 @@ type Upload struct {
 	Src  Path
 	Dest Path
 	Perm Perm
+
+	// Become, if non-nil, installs the upload as another user: it is first
+	// uploaded to a temporary staging directory as the SSH user and then
+	// copied to Dest as the [Become] target user.
+	Become *Become
 }
 
 // Apply performs the upload.
 func (u Upload) Apply(ctx context.Context, host Host) error {
+	if u.Become != nil {
+		return u.Become.upload(ctx, host, u)
+	}
 	return copyAction{src: u.Src, dest: u.Dest, perm: u.Perm, fetch: false}.Apply(ctx, host)
 }
 
@@ -144,21 +153,143 @@ func UploadFile(ctx context.Context, host Host, localPath, remotePath string, pe
 }
 
 // Download downloads a file or directory from a remote host.
-// For each host in a group, a subdirectory named after the host is created
-// under Dest so that results from multiple hosts do not collide.
+// Since a download typically runs on every host in a group, the local
+// destination is made unique per host by Naming. When Naming is nil, a
+// fetched directory is placed in a subdirectory of Dest named after the host,
+// and a fetched file is saved as Dest with the host's name appended
+// (e.g. log.txt.wrk1).
 // Use DownloadDir when you are downloading from a single host and want the
 // remote directory's contents placed directly into the local destination.
 type Download struct {
 	Src  Path
 	Dest Path
 	Perm Perm
+
+	// Naming derives the host-specific local destination from Dest.
+	// See [HostSubdir], [HostPrefix], [HostSuffix] and [HostBeforeExt].
+	Naming NamingFunc
+
+	// Names records the destination claimed by each host and fails a
+	// download whose destination overlaps one claimed by another host. When
+	// Names is nil, the downloads of one [Group.Run] are checked against each
+	// other; set it to check across several runs.
+	Names *DownloadNames
 }
 
 // Apply performs the download.
 func (d Download) Apply(ctx context.Context, host Host) error {
-	return copyAction{src: d.Src, dest: d.Dest, perm: d.Perm, fetch: true}.Apply(ctx, host)
+	return copyAction{src: d.Src, dest: d.Dest, perm: d.Perm, fetch: true, naming: d.Naming, names: d.Names}.Apply(ctx, host)
+}
+
+// NamingFunc returns the local destination for a file or directory fetched
+// from host by [Download]. dest is the slash-separated path of Download.Dest
+// relative to its prefix, and the returned path is interpreted the same way.
+// isDir reports whether a directory is fetched.
+type NamingFunc func(host Host, dest string, isDir bool) string
+
+// HostSubdir places the download in a subdirectory named after the host. A
+// fetched directory goes into a subdirectory of dest: out becomes out/wrk1. A
+// fetched file goes into a subdirectory next to where dest would have been:
+// out/log.txt becomes out/wrk1/log.txt.
+func HostSubdir(host Host, dest string, isDir bool) string {
+	if isDir {
+		return path.Join(dest, host.Name())
+	}
+	dir, base := path.Split(dest)
+	return path.Join(dir, host.Name(), base)
+}
+
+// HostPrefix prepends the host's name to the base name of dest:
+// out/log.txt becomes out/wrk1.log.txt.
+func HostPrefix(host Host, dest string, _ bool) string {
+	dir, base := path.Split(dest)
+	return path.Join(dir, host.Name()+"."+base)
+}
+
+// HostSuffix appends the host's name to dest: out/log.txt becomes
+// out/log.txt.wrk1. This is how a fetched file is named when
+// Download.Naming is nil.
+func HostSuffix(host Host, dest string, _ bool) string {
+	return dest + "." + host.Name()
+}
+
+// HostBeforeExt inserts the host's name before the extension of dest, so that
+// tools matching files by suffix still recognize the result: out/log.txt
+// becomes out/log.wrk1.txt. Only the last extension is considered
+// (out/a.tar.gz becomes out/a.tar.wrk1.gz), and a name without an extension,
+// including a dotfile such as .bashrc, gets the host's name appended.
+func HostBeforeExt(host Host, dest string, _ bool) string {
+	dir, base := path.Split(dest)
+	ext := path.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	return path.Join(dir, strings.TrimSuffix(base, ext)+"."+host.Name()+ext)
+}
+
+// legacyNaming returns the destination used when Download.Naming is nil.
+func legacyNaming(host Host, dest string, isDir bool) string {
+	if isDir {
+		return HostSubdir(host, dest, isDir)
+	}
+	return HostSuffix(host, dest, isDir)
 }
 
+// ErrNameCollision is returned by [Download] when the destination derived for
+// a host is, contains or lies within one already claimed by another host.
+var ErrNameCollision = errors.New("download destination claimed by another host")
+
+// DownloadNames detects collisions between the local destinations of
+// downloads from different hosts, such as a [NamingFunc] that ignores the
+// host. Each [Group.Run] uses its own; share one across several runs by
+// setting Download.Names. It is safe for concurrent use, and the zero value
+// is ready to use.
+type DownloadNames struct {
+	mu      sync.Mutex
+	claimed map[string]string // local destination -> host name
+}
+
+// claim records that hostName downloads to dest. It fails if another host
+// claimed dest, a directory containing it, or a path within it. Downloading
+// to the same destination again from the same host is allowed, so a task can
+// be re-run.
+func (n *DownloadNames) claim(dest, hostName string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for claimed, owner := range n.claimed {
+		if owner != hostName && pathsOverlap(dest, claimed) {
+			return fmt.Errorf("'%s': %w ('%s' from %s)", dest, ErrNameCollision, claimed, owner)
+		}
+	}
+	if n.claimed == nil {
+		n.claimed = make(map[string]string)
+	}
+	n.claimed[dest] = hostName
+	return nil
+}
+
+// Host returns the name of the host that claimed dest, which must be given
+// as the full local path, and whether it was claimed at all.
+func (n *DownloadNames) Host(dest string) (hostName string, ok bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	hostName, ok = n.claimed[filepath.Clean(dest)]
+	return hostName, ok
+}
+
+// pathsOverlap reports whether the cleaned paths a and b are the same, or one
+// lies within the other.
+func pathsOverlap(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a == b || strings.HasPrefix(b, a+string(filepath.Separator))
+}
+
+// downloadNamesKey is the context key of the [DownloadNames] of a
+// [Group.Run], used by downloads that do not set Download.Names.
+type downloadNamesKey struct{}
+
 // ProgressFunc is called during a file transfer to report incremental progress.
 // n is the number of bytes just transferred.
 type ProgressFunc func(n int64)
@@ -221,13 +352,15 @@ func totalSize(fsys fs.FS, dir string) (int64, error) {
 }
 
 type copyAction struct {
-	src   Path
-	dest  Path
-	fetch bool
-	perm  Perm
+	src    Path
+	dest   Path
+	fetch  bool
+	perm   Perm
+	naming NamingFunc
+	names  *DownloadNames
 }
 
-func (ca copyAction) Apply(_ context.Context, host Host) (err error) {
+func (ca copyAction) Apply(ctx context.Context, host Host) (err error) {
 	var (
 		from fs.FS
 		to   fs.FS
@@ -251,22 +384,51 @@ func (ca copyAction) Apply(_ context.Context, host Host) (err error) {
 		return err
 	}
 
-	if info.IsDir() {
-		dest := ca.dest.path
-		if ca.fetch {
-			// since we might be copying from multiple hosts, we will create a subdirectory in the destination folder
-			dest = filepath.Join(dest, host.Name())
-		}
-		return copyDir(ca.src.path, dest, ca.perm, from, to, nil)
-	}
 	dest := ca.dest.path
 	if ca.fetch {
-		// since we might be copying from multiple hosts, we add the host's name to the destination file
-		dest += "." + host.Name()
+		// since we might be copying from multiple hosts, the destination is made unique per host
+		dest, err = ca.fetchDest(ctx, host, info.IsDir())
+		if err != nil {
+			return err
+		}
+		// a naming function such as HostSubdir may place a file in a new directory
+		if !info.IsDir() {
+			if err := fs.MkdirAll(to, path.Dir(dest), ca.perm.GetDirPerm()); err != nil {
+				return err
+			}
+		}
+	}
+	if info.IsDir() {
+		return copyDir(ca.src.path, dest, ca.perm, from, to, nil)
 	}
 	return copyFile(ca.src.path, dest, ca.perm, from, to, nil)
 }
 
+// fetchDest returns the host-specific destination of a download, relative to
+// the destination prefix, and claims it in ca.names, or else in the
+// [DownloadNames] of the enclosing [Group.Run], if any.
+func (ca copyAction) fetchDest(ctx context.Context, host Host, isDir bool) (string, error) {
+	var dest string
+	if ca.naming != nil {
+		dest = CleanPath(ca.naming(host, ca.dest.path, isDir))
+	} else {
+		dest = legacyNaming(host, ca.dest.path, isDir)
+	}
+	if !fs.ValidPath(dest) {
+		return "", fmt.Errorf("download destination '%s': %w", dest, fs.ErrInvalid)
+	}
+	names := ca.names
+	if names == nil {
+		names, _ = ctx.Value(downloadNamesKey{}).(*DownloadNames)
+	}
+	if names != nil {
+		if err := names.claim(filepath.Join(ca.dest.prefix, dest), host.Name()); err != nil {
+			return "", err
+		}
+	}
+	return dest, nil
+}
+
 func copyDir(src, dest string, perm Perm, from, to fs.FS, progress ProgressFunc) error {
 	files, err := fs.ReadDir(from, src)
 	if err != nil {
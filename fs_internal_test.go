@@ -2,6 +2,7 @@ package iago
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -31,3 +32,135 @@ func TestUploadFile(t *testing.T) {
 		t.Fatalf("uploaded content = %q, want %q", got, want)
 	}
 }
+
+func TestDownloadNaming(t *testing.T) {
+	host := fakeHost{name: "wrk1"}
+	tests := []struct {
+		name   string
+		naming NamingFunc
+		dest   string
+		isDir  bool
+		want   string
+	}{
+		{name: "subdir", naming: HostSubdir, dest: "out/log.txt", want: "out/wrk1/log.txt"},
+		{name: "subdir dir", naming: HostSubdir, dest: "out", isDir: true, want: "out/wrk1"},
+		{name: "subdir top level", naming: HostSubdir, dest: "log.txt", want: "wrk1/log.txt"},
+		{name: "prefix", naming: HostPrefix, dest: "out/log.txt", want: "out/wrk1.log.txt"},
+		{name: "suffix", naming: HostSuffix, dest: "out/log.txt", want: "out/log.txt.wrk1"},
+		{name: "before ext", naming: HostBeforeExt, dest: "out/log.txt", want: "out/log.wrk1.txt"},
+		{name: "before last ext", naming: HostBeforeExt, dest: "a.tar.gz", want: "a.tar.wrk1.gz"},
+		{name: "before ext without ext", naming: HostBeforeExt, dest: "out/log", want: "out/log.wrk1"},
+		{name: "before ext dotfile", naming: HostBeforeExt, dest: ".bashrc", want: ".bashrc.wrk1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.naming(host, tt.dest, tt.isDir); got != tt.want {
+				t.Errorf("naming(%q) = %q, want %q", tt.dest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadNamingApply(t *testing.T) {
+	remoteDir, localDir := t.TempDir(), t.TempDir()
+	if err := os.MkdirAll(filepath.Join(remoteDir, "var"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(remoteDir, "var", "log.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewPath("/var", "log.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := NewPath(localDir, "log.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names DownloadNames
+	for _, name := range []string{"wrk1", "wrk2"} {
+		host := fakeHost{name: name, fsys: wrfs.DirFS(remoteDir)}
+		err := Download{Src: src, Dest: dest, Naming: HostBeforeExt, Names: &names}.Apply(context.Background(), host)
+		if err != nil {
+			t.Fatalf("Download from %s: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(localDir, "log."+name+".txt")); err != nil {
+			t.Errorf("downloaded file for %s: %v", name, err)
+		}
+	}
+	if owner, ok := names.Host(filepath.Join(localDir, "log.wrk2.txt")); !ok || owner != "wrk2" {
+		t.Errorf("Host(log.wrk2.txt) = %q, %v, want wrk2, true", owner, ok)
+	}
+
+	// A naming function that ignores the host maps every host to the same file.
+	same := func(_ Host, dest string, _ bool) string { return dest }
+	for i, name := range []string{"wrk1", "wrk2"} {
+		host := fakeHost{name: name, fsys: wrfs.DirFS(remoteDir)}
+		err := Download{Src: src, Dest: dest, Naming: same, Names: &names}.Apply(context.Background(), host)
+		if wantErr := i > 0; wantErr != errors.Is(err, ErrNameCollision) {
+			t.Errorf("Download from %s: error = %v, want collision %v", name, err, wantErr)
+		}
+	}
+}
+
+func TestDownloadNamesOverlap(t *testing.T) {
+	out := filepath.Join("tmp", "out")
+	tests := []struct {
+		name    string
+		claimed string
+		dest    string
+		want    bool
+	}{
+		{name: "same", claimed: out, dest: out, want: true},
+		{name: "within", claimed: out, dest: filepath.Join(out, "wrk2", "log.txt"), want: true},
+		{name: "contains", claimed: filepath.Join(out, "wrk1"), dest: out, want: true},
+		{name: "sibling", claimed: filepath.Join(out, "wrk1"), dest: filepath.Join(out, "wrk10"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names DownloadNames
+			if err := names.claim(tt.claimed, "wrk1"); err != nil {
+				t.Fatal(err)
+			}
+			err := names.claim(tt.dest, "wrk2")
+			if got := errors.Is(err, ErrNameCollision); got != tt.want {
+				t.Errorf("claim(%s) after %s error = %v, want collision %v", tt.dest, tt.claimed, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadNamesPerRun(t *testing.T) {
+	remoteDir, localDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(remoteDir, "log.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewPath("/", "log.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := NewPath(localDir, "log.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGroup([]Host{
+		fakeHost{name: "wrk1", fsys: wrfs.DirFS(remoteDir)},
+		fakeHost{name: "wrk2", fsys: wrfs.DirFS(remoteDir)},
+	})
+	var errs Errors
+	g.ErrorHandler = errs.Handle
+	same := func(_ Host, dest string, _ bool) string { return dest }
+	g.Run("fetch", Download{Src: src, Dest: dest, Naming: same}.Apply)
+	if !errors.Is(errs.Err(), ErrNameCollision) {
+		t.Errorf("Run() error = %v, want %v", errs.Err(), ErrNameCollision)
+	}
+
+	// Each run checks only its own downloads.
+	errs = Errors{}
+	g.Run("fetch", Download{Src: src, Dest: dest, Naming: HostSubdir}.Apply)
+	g.Run("fetch again", Download{Src: src, Dest: dest, Naming: HostSubdir}.Apply)
+	if err := errs.Err(); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
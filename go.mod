@@ -3,11 +3,14 @@ module github.com/relab/iago
 go 1.26.2
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/kevinburke/ssh_config v1.6.0
 	github.com/pkg/sftp v1.13.10
 	github.com/relab/container v0.0.0-20260109140004-4adfae874bb5
 	github.com/relab/wrfs v0.0.0-20220416082020-a641cd350078
 	golang.org/x/crypto v0.52.0
+	golang.org/x/term v0.43.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
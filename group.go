@@ -0,0 +1,88 @@
+package iago
+
+import (
+	"reflect"
+	"slices"
+)
+
+// derive returns a view of g holding hosts.
+func (g Group) derive(hosts []Host) Group {
+	g.Hosts = hosts
+	g.DialErrors = nil
+	g.sharedClosers = nil
+	g.view = true
+	return g
+}
+
+// Filter returns a view of g holding the hosts for which keep returns true:
+//
+//	leaders := g.Filter(func(h iago.Host) bool { return iago.GetStringVar(h, "role") == "leader" })
+//	leaders.Run("start leader", startLeader)
+func (g Group) Filter(keep func(Host) bool) Group {
+	var hosts []Host
+	for _, h := range g.Hosts {
+		if keep(h) {
+			hosts = append(hosts, h)
+		}
+	}
+	return g.derive(hosts)
+}
+
+// Partition returns two views of g: one holding the hosts for which pred
+// returns true and one holding the rest.
+func (g Group) Partition(pred func(Host) bool) (matched, rest Group) {
+	var in, out []Host
+	for _, h := range g.Hosts {
+		if pred(h) {
+			in = append(in, h)
+		} else {
+			out = append(out, h)
+		}
+	}
+	return g.derive(in), g.derive(out)
+}
+
+// Union returns a view holding the hosts of g followed by the hosts of others
+// that are not already included.
+func (g Group) Union(others ...Group) Group {
+	hosts := slices.Clone(g.Hosts)
+	seen := hostNames(g.Hosts)
+	for _, other := range others {
+		for _, h := range other.Hosts {
+			if !seen[h.Name()] {
+				seen[h.Name()] = true
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	return g.derive(hosts)
+}
+
+// Except returns a view of g without the hosts that are in any of others.
+func (g Group) Except(others ...Group) Group {
+	excluded := make(map[string]bool)
+	for _, other := range others {
+		for name := range hostNames(other.Hosts) {
+			excluded[name] = true
+		}
+	}
+	return g.Filter(func(h Host) bool { return !excluded[h.Name()] })
+}
+
+// ByVar returns a view of g holding the hosts whose variable key is equal to
+// val, as compared by [reflect.DeepEqual].
+func (g Group) ByVar(key string, val any) Group {
+	return g.Filter(func(h Host) bool {
+		v, ok := h.GetVar(key)
+		return ok && reflect.DeepEqual(v, val)
+	})
+}
+
+// hostNames returns the set of names of hosts.
+func hostNames(hosts []Host) map[string]bool {
+	names := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		names[h.Name()] = true
+	}
+	return names
+}
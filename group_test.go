@@ -0,0 +1,119 @@
+package iago
+
+import (
+	"io"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// closeCountHost is a fakeHost that counts how many times it is closed.
+type closeCountHost struct {
+	fakeHost
+	closed *atomic.Int32
+}
+
+func (h closeCountHost) Close() error {
+	h.closed.Add(1)
+	return nil
+}
+
+func groupNames(g Group) []string {
+	names := make([]string, len(g.Hosts))
+	for i, h := range g.Hosts {
+		names[i] = h.Name()
+	}
+	return names
+}
+
+func newVarsGroup(roles map[string]string, names ...string) Group {
+	hosts := make([]Host, len(names))
+	for i, name := range names {
+		h := newVarsHost(name)
+		if role, ok := roles[name]; ok {
+			h.SetVar("role", role)
+		}
+		hosts[i] = h
+	}
+	return NewGroup(hosts)
+}
+
+func TestGroupSetOperations(t *testing.T) {
+	g := newVarsGroup(map[string]string{"a": "leader", "b": "replica", "c": "replica"}, "a", "b", "c", "d")
+	isReplica := func(h Host) bool { return GetStringVar(h, "role") == "replica" }
+
+	tests := []struct {
+		name string
+		got  Group
+		want []string
+	}{
+		{name: "Filter", got: g.Filter(isReplica), want: []string{"b", "c"}},
+		{name: "ByVar", got: g.ByVar("role", "leader"), want: []string{"a"}},
+		{name: "ByVarMissing", got: g.ByVar("role", "client"), want: nil},
+		{name: "Except", got: g.Except(g.Filter(isReplica)), want: []string{"a", "d"}},
+		{name: "Union", got: g.ByVar("role", "leader").Union(g.Filter(isReplica), g.ByVar("role", "leader")), want: []string{"a", "b", "c"}},
+		{name: "Chained", got: g.Filter(isReplica).Except(g.ByVar("role", "leader")).Filter(func(h Host) bool { return h.Name() != "b" }), want: []string{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupNames(tt.got); !slices.Equal(got, tt.want) {
+				t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	matched, rest := g.Partition(isReplica)
+	if got := groupNames(matched); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("Partition matched = %q, want [b c]", got)
+	}
+	if got := groupNames(rest); !slices.Equal(got, []string{"a", "d"}) {
+		t.Errorf("Partition rest = %q, want [a d]", got)
+	}
+}
+
+func TestGroupViewInheritsSettings(t *testing.T) {
+	g := newVarsGroup(nil, "a", "b")
+	var errs Errors
+	g.ErrorHandler = errs.Handle
+	g.Timeout = 42
+	g.DialErrors = map[string]error{"c": ErrNotAbsolute}
+	v := g.Filter(func(Host) bool { return true })
+	if v.Timeout != 42 || v.ErrorHandler == nil || v.DialErrors != nil {
+		t.Errorf("view Timeout = %v, ErrorHandler set = %t, DialErrors = %v", v.Timeout, v.ErrorHandler != nil, v.DialErrors)
+	}
+}
+
+func TestGroupViewClose(t *testing.T) {
+	var closed atomic.Int32
+	jumpClosed := 0
+	hosts := []Host{
+		closeCountHost{fakeHost{name: "a"}, &closed},
+		closeCountHost{fakeHost{name: "b"}, &closed},
+	}
+	g := NewGroup(hosts)
+	g.sharedClosers = []io.Closer{closerFunc(func() error { jumpClosed++; return nil })}
+
+	views := []Group{
+		g.Filter(func(h Host) bool { return h.Name() == "a" }),
+		g.Union(g),
+		g.Except(g.Filter(func(h Host) bool { return h.Name() == "a" })),
+	}
+	for _, v := range views {
+		if err := v.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if closed.Load() != 0 || jumpClosed != 0 {
+		t.Fatalf("closing views closed %d hosts and %d shared resources, want none", closed.Load(), jumpClosed)
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if closed.Load() != 2 || jumpClosed != 1 {
+		t.Errorf("closing the owning group closed %d hosts and %d shared resources, want 2 and 1", closed.Load(), jumpClosed)
+	}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
@@ -0,0 +1,146 @@
+package iago
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPlayAborted is reported by [Group.Run] when more hosts have failed than
+// allowed by [FailurePolicy.MaxFailPercent].
+var ErrPlayAborted = errors.New("play aborted")
+
+// FailurePolicy controls how a [Group] treats hosts that fail tasks. A group
+// always records the hosts whose task failed in [Group.Run], which
+// [Group.Failed] and [Group.Healthy] report; the policy decides what later
+// runs do about them. The failures are shared by a group and its views, such
+// as those returned by [Group.Filter].
+type FailurePolicy struct {
+	// SkipFailed skips hosts that failed an earlier task in later runs, so
+	// that a play continues on the hosts that are still healthy.
+	SkipFailed bool
+	// MaxFailPercent aborts the play once more than this percentage of the
+	// hosts of the running group have failed: the run in which the limit is
+	// exceeded reports [ErrPlayAborted] to the ErrorHandler, and every later
+	// run reports it again instead of running. Nil means no limit, and zero
+	// aborts the play on the first failure:
+	//
+	//	iago.FailurePolicy{MaxFailPercent: new(10.0)}
+	MaxFailPercent *float64
+}
+
+// groupHealth records the hosts of a group that failed tasks.
+type groupHealth struct {
+	mu      sync.Mutex
+	failed  map[string]error
+	aborted error
+}
+
+// fail records that host failed with err, keeping its first error.
+func (h *groupHealth) fail(host string, err error) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failed == nil {
+		h.failed = make(map[string]error)
+	}
+	if _, ok := h.failed[host]; !ok {
+		h.failed[host] = err
+	}
+}
+
+// isFailed reports whether host has failed.
+func (h *groupHealth) isFailed(host string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.failed[host]
+	return ok
+}
+
+// abortErr returns the error the play was aborted with, if any.
+func (h *groupHealth) abortErr() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.aborted
+}
+
+// checkAbort aborts the play if more than maxPercent of hosts have failed,
+// and returns the abort error the first time.
+func (h *groupHealth) checkAbort(hosts []Host, maxPercent *float64) error {
+	if h == nil || maxPercent == nil || len(hosts) == 0 {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.aborted != nil {
+		return nil
+	}
+	failed := 0
+	for _, host := range hosts {
+		if _, ok := h.failed[host.Name()]; ok {
+			failed++
+		}
+	}
+	percent := 100 * float64(failed) / float64(len(hosts))
+	if percent <= *maxPercent {
+		return nil
+	}
+	h.aborted = fmt.Errorf("%w: %d of %d hosts failed (%.0f%% > %g%%)", ErrPlayAborted, failed, len(hosts), percent, *maxPercent)
+	return h.aborted
+}
+
+// FailurePolicy returns the failure policy of the group.
+func (g Group) FailurePolicy() FailurePolicy {
+	return g.failures
+}
+
+// SetFailurePolicy sets the failure policy of the group. Views derived from
+// the group afterwards inherit it.
+func (g *Group) SetFailurePolicy(p FailurePolicy) {
+	g.failures = p
+}
+
+// Failed returns the hosts of the group that failed a task, with the first
+// error each of them failed with, keyed by host name.
+func (g Group) Failed() map[string]error {
+	if g.health == nil {
+		return nil
+	}
+	g.health.mu.Lock()
+	defer g.health.mu.Unlock()
+	failed := make(map[string]error)
+	for _, host := range g.Hosts {
+		if err, ok := g.health.failed[host.Name()]; ok {
+			failed[host.Name()] = err
+		}
+	}
+	return failed
+}
+
+// Healthy returns a view of the group holding the hosts that have not failed
+// a task.
+func (g Group) Healthy() Group {
+	return g.Filter(func(h Host) bool { return !g.health.isFailed(h.Name()) })
+}
+
+// ResetFailures forgets the failures of the hosts of the group, for example
+// after they have been repaired, and lifts an abort of the play.
+func (g Group) ResetFailures() {
+	if g.health == nil {
+		return
+	}
+	g.health.mu.Lock()
+	defer g.health.mu.Unlock()
+	for _, host := range g.Hosts {
+		delete(g.health.failed, host.Name())
+	}
+	g.health.aborted = nil
+}
@@ -0,0 +1,140 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+// failOn returns a task that fails on the named hosts and counts the hosts it
+// runs on.
+func failOn(ran *atomic.Int32, names ...string) func(context.Context, Host) error {
+	return func(_ context.Context, h Host) error {
+		ran.Add(1)
+		if slices.Contains(names, h.Name()) {
+			return errors.New("boom")
+		}
+		return nil
+	}
+}
+
+func TestGroupTracksFailures(t *testing.T) {
+	g := newVarsGroup(nil, "a", "b", "c", "d")
+	var errs Errors
+	g.ErrorHandler = errs.Handle
+
+	var ran atomic.Int32
+	g.Run("first", failOn(&ran, "b"))
+	failed := g.Failed()
+	if len(failed) != 1 || failed["b"] == nil {
+		t.Fatalf("Failed() = %v, want only b", failed)
+	}
+	if got := groupNames(g.Healthy()); !slices.Equal(got, []string{"a", "c", "d"}) {
+		t.Errorf("Healthy() = %q, want [a c d]", got)
+	}
+
+	// Without SkipFailed, failed hosts keep running tasks.
+	ran.Store(0)
+	g.Run("second", failOn(&ran))
+	if ran.Load() != 4 {
+		t.Errorf("second run ran on %d hosts, want 4", ran.Load())
+	}
+
+	// Views share failures with the group they are derived from.
+	v := g.Filter(func(h Host) bool { return h.Name() != "a" })
+	v.Run("third", failOn(&ran, "c"))
+	if got := len(g.Failed()); got != 2 {
+		t.Errorf("owning group has %d failures after a view's run, want 2", got)
+	}
+	if got := len(v.Except(g.Filter(func(h Host) bool { return h.Name() == "c" })).Failed()); got != 1 {
+		t.Errorf("Failed() of a view without c has %d failures, want 1", got)
+	}
+
+	g.ResetFailures()
+	if got := len(g.Failed()); got != 0 {
+		t.Errorf("Failed() after ResetFailures has %d failures, want 0", got)
+	}
+}
+
+func TestGroupSkipFailed(t *testing.T) {
+	g := newVarsGroup(nil, "a", "b", "c")
+	var errs Errors
+	g.ErrorHandler = errs.Handle
+	g.SetFailurePolicy(FailurePolicy{SkipFailed: true})
+
+	var ran atomic.Int32
+	g.Run("first", failOn(&ran, "a"))
+	ran.Store(0)
+	g.Run("second", failOn(&ran, "b"))
+	if ran.Load() != 2 {
+		t.Errorf("second run ran on %d hosts, want 2", ran.Load())
+	}
+	ran.Store(0)
+	g.Run("third", failOn(&ran))
+	if ran.Load() != 1 {
+		t.Errorf("third run ran on %d hosts, want 1", ran.Load())
+	}
+}
+
+func TestGroupMaxFailPercent(t *testing.T) {
+	g := newVarsGroup(nil, "a", "b", "c", "d")
+	var errs Errors
+	g.ErrorHandler = errs.Handle
+	g.SetFailurePolicy(FailurePolicy{MaxFailPercent: new(25.0)})
+
+	var ran atomic.Int32
+	g.Run("first", failOn(&ran, "a"))
+	if errors.Is(errs.Err(), ErrPlayAborted) {
+		t.Fatal("play aborted at 25% failed, want limit exceeded only above 25%")
+	}
+	g.Run("second", failOn(&ran, "b"))
+	if !errors.Is(errs.Err(), ErrPlayAborted) {
+		t.Fatalf("errors = %v, want %v after 50%% failed", errs.Err(), ErrPlayAborted)
+	}
+
+	ran.Store(0)
+	g.Run("third", failOn(&ran))
+	if ran.Load() != 0 {
+		t.Errorf("run after abort ran on %d hosts, want 0", ran.Load())
+	}
+
+	g.ResetFailures()
+	g.Run("fourth", failOn(&ran))
+	if ran.Load() != 4 {
+		t.Errorf("run after ResetFailures ran on %d hosts, want 4", ran.Load())
+	}
+}
+
+func TestGroupMaxFailPercentZero(t *testing.T) {
+	g := newVarsGroup(nil, "a", "b", "c", "d")
+	var errs Errors
+	g.ErrorHandler = errs.Handle
+	g.SetFailurePolicy(FailurePolicy{MaxFailPercent: new(0.0)})
+
+	var ran atomic.Int32
+	g.Run("first", failOn(&ran))
+	if errs.Err() != nil {
+		t.Fatalf("errors = %v after a run without failures, want none", errs.Err())
+	}
+	g.Run("second", failOn(&ran, "a"))
+	if !errors.Is(errs.Err(), ErrPlayAborted) {
+		t.Errorf("errors = %v, want %v after the first failure", errs.Err(), ErrPlayAborted)
+	}
+}
+
+func TestGroupMaxFailPercentView(t *testing.T) {
+	g := newVarsGroup(nil, "a", "b", "c", "d")
+	var errs Errors
+	g.ErrorHandler = errs.Handle
+	g.SetFailurePolicy(FailurePolicy{MaxFailPercent: new(50.0)})
+
+	// Both hosts of the view fail: 100% of the view, but only 50% of g.
+	v := g.Filter(func(h Host) bool { return h.Name() == "a" || h.Name() == "b" })
+	var ran atomic.Int32
+	v.Run("first", failOn(&ran, "a", "b"))
+	if !errors.Is(errs.Err(), ErrPlayAborted) {
+		t.Errorf("errors = %v, want %v after every host of the view failed", errs.Err(), ErrPlayAborted)
+	}
+}
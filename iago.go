@@ -38,7 +38,9 @@ type Host interface {
 	// Close closes the connection to the host.
 	Close() error
 
-	// SetVar sets a host variable with the given key and value
+	// SetVar sets a host variable with the given key and value.
+	// Implementations must be safe for concurrent use; embedding [Vars]
+	// provides SetVar and GetVar.
 	SetVar(key string, val any)
 
 	// GetVar gets the host variable with the given key.
@@ -51,7 +53,9 @@ func Expand(h Host, s string) string {
 	return os.Expand(s, h.GetEnv)
 }
 
-// GetStringVar gets a string variable from the host.
+// GetStringVar gets a string variable from the host. It returns the empty
+// string if the variable does not exist or is not a string; use [GetVar] to
+// tell those cases apart.
 func GetStringVar(host Host, key string) string {
 	val, ok := host.GetVar(key)
 	if ok {
@@ -61,7 +65,9 @@ func GetStringVar(host Host, key string) string {
 	return ""
 }
 
-// GetIntVar gets an integer variable from the host.
+// GetIntVar gets an integer variable from the host. It returns zero if the
+// variable does not exist or is not an int; use [GetVar] to tell those cases
+// apart.
 func GetIntVar(host Host, key string) int {
 	val, ok := host.GetVar(key)
 	if ok {
@@ -75,11 +81,19 @@ func GetIntVar(host Host, key string) int {
 type GroupOption func(*groupConfig)
 
 type groupConfig struct {
-	failFast          bool
-	dialConcurrency   int
-	forwardAgent      bool
-	keepAliveInterval time.Duration
-	errorHandler      ErrorHandler
+	failFast            bool
+	dialConcurrency     int
+	forwardAgent        bool
+	keepAliveInterval   time.Duration
+	errorHandler        ErrorHandler
+	hostVars            map[string]map[string]any
+	inventoryVars       map[string]map[string]any
+	failurePolicy       FailurePolicy
+	reconnect           *ReconnectPolicy
+	proxy               string
+	password            PasswordCallback
+	keyboardInteractive KeyboardInteractiveCallback
+	passphrase          PassphraseCallback
 }
 
 func applyGroupOptions(opts ...GroupOption) groupConfig {
@@ -127,6 +141,24 @@ func KeepAlive(interval time.Duration) GroupOption {
 	}
 }
 
+// HostVars returns a [GroupOption] that seeds the variables of each dialed
+// host from vars, keyed by host alias and then by variable name. They take
+// precedence over variables set with IagoVar in the SSH config and in an
+// [Inventory].
+func HostVars(vars map[string]map[string]any) GroupOption {
+	return func(cfg *groupConfig) {
+		cfg.hostVars = vars
+	}
+}
+
+// WithFailurePolicy returns a [GroupOption] that sets the [FailurePolicy] of
+// the group returned by [NewSSHGroup].
+func WithFailurePolicy(p FailurePolicy) GroupOption {
+	return func(cfg *groupConfig) {
+		cfg.failurePolicy = p
+	}
+}
+
 // ForwardAgent returns a [GroupOption] that forces SSH agent forwarding for
 // every host in the group, regardless of the ForwardAgent setting in the SSH
 // config. This is equivalent to passing -A to the ssh command-line tool:
@@ -149,6 +181,10 @@ func ForwardAgent() GroupOption {
 //	// ...
 //	g.Run("task", task)
 //	return errs.Err()
+//
+// The handler also receives problems that do not fail a dial, such as an
+// unusable key or a port forward of the SSH config that failed to start or
+// to forward a connection; without the option, these are ignored.
 func WithErrorHandler(h ErrorHandler) GroupOption {
 	return func(cfg *groupConfig) {
 		cfg.errorHandler = h
@@ -156,6 +192,13 @@ func WithErrorHandler(h ErrorHandler) GroupOption {
 }
 
 // Group is a group of hosts.
+//
+// Methods such as [Group.Filter] and [Group.Union] return views: groups
+// holding some of the hosts of the groups they are derived from, sharing their
+// connections. The group returned by [NewGroup] or [NewSSHGroup] remains
+// responsible for closing the connections, so [Group.Close] on a view does
+// nothing. Views inherit the ErrorHandler and Timeout of the group they are
+// derived from. Hosts are identified by name.
 type Group struct {
 	Hosts        []Host
 	ErrorHandler ErrorHandler
@@ -170,6 +213,17 @@ type Group struct {
 	// host shared by all targets that route through it). They are closed
 	// after all hosts on [Group.Close].
 	sharedClosers []io.Closer
+
+	// view is set on groups derived from another group, such as by
+	// [Group.Filter], which share its connections without owning them.
+	view bool
+
+	// failures controls how hosts that fail tasks are treated in later runs.
+	failures FailurePolicy
+
+	// health records the hosts that failed tasks. It is shared by the views
+	// of a group; nil for a Group not created by [NewGroup].
+	health *groupHealth
 }
 
 // NewGroup returns a new Group consisting of the given hosts.
@@ -178,27 +232,48 @@ func NewGroup(hosts []Host) Group {
 		Hosts:        hosts,
 		ErrorHandler: Panic,
 		Timeout:      DefaultTimeout,
+		health:       &groupHealth{},
 	}
 }
 
-// Run runs the task on all hosts in the group concurrently.
+// Run runs the task on all hosts in the group concurrently. Hosts whose task
+// fails are recorded as failed; see [FailurePolicy]. Downloads made by the
+// task fail if two hosts would write to overlapping local destinations; see
+// [Download].
 func (g Group) Run(name string, f func(context.Context, Host) error) {
+	if err := g.health.abortErr(); err != nil {
+		g.ErrorHandler(fmt.Errorf("iago: %s: %w", name, err))
+		return
+	}
+	hosts := g.Hosts
+	if g.failures.SkipFailed {
+		hosts = g.Healthy().Hosts
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
 	defer cancel()
+	ctx = context.WithValue(ctx, downloadNamesKey{}, new(DownloadNames))
 
 	errors := make(chan error)
-	for _, h := range g.Hosts {
+	for _, h := range hosts {
 		go func(h Host) {
-			errors <- wrapError(h.Name(), name, f(ctx, h))
+			err := f(ctx, h)
+			if err != nil {
+				g.health.fail(h.Name(), err)
+			}
+			errors <- wrapError(h.Name(), name, err)
 		}(h)
 	}
 
-	for range g.Hosts {
+	for range hosts {
 		err := <-errors
 		if err != nil {
 			g.ErrorHandler(err)
 		}
 	}
+	if err := g.health.checkAbort(g.Hosts, g.failures.MaxFailPercent); err != nil {
+		g.ErrorHandler(fmt.Errorf("iago: %s: %w", name, err))
+	}
 }
 
 // Collect runs fn concurrently on every host in g and returns each host's
@@ -229,8 +304,13 @@ func Collect[T any](g Group, name string, fn func(context.Context, Host) (T, err
 // Close closes any connections to hosts and any group-owned shared resources
 // (such as ProxyJump connections shared across hosts in this group).
 // Hosts are closed concurrently; shared resources (e.g. ProxyJump clients)
-// are closed sequentially after all hosts have been closed.
+// are closed sequentially after all hosts have been closed. Closing a view of
+// another group, such as one returned by [Group.Filter], does nothing, since
+// the connections belong to the group it was derived from.
 func (g Group) Close() error {
+	if g.view {
+		return nil
+	}
 	errs := make([]error, len(g.Hosts))
 	var wg sync.WaitGroup
 	for i, h := range g.Hosts {
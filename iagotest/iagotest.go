@@ -25,27 +25,45 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-const tag = "iago-test"
-
 var (
 	//go:embed Dockerfile
 	dockerfile []byte
+	//go:embed Dockerfile.debian
+	debianDockerfile []byte
 	//go:embed entrypoint.sh
 	entrypoint []byte
 )
 
+// image is a container image running an SSH server for the tests.
+type image struct {
+	tag        string
+	dockerfile []byte
+}
+
+var (
+	// alpineImage is the image used by default; its package manager is apk.
+	alpineImage = image{tag: "iago-test", dockerfile: dockerfile}
+	// debianImage is used to test apt.
+	debianImage = image{tag: "iago-test-debian", dockerfile: debianDockerfile}
+)
+
 // CreateSSHGroup starts n docker containers and connects to them with ssh.
 // If skip is true, this function will call t.Skip() if docker is unavailable.
 func CreateSSHGroup(t testing.TB, n int, skip bool) (g iago.Group) {
+	return createSSHGroup(t, alpineImage, n, skip)
+}
+
+// createSSHGroup is like CreateSSHGroup, but starts the containers from img.
+func createSSHGroup(t testing.TB, img image, n int, skip bool) (g iago.Group) {
 	signer, _, _ := generateKey(t)
 
-	cli, network := setupContainerEnvironment(t, skip)
+	cli, network := setupImageEnvironment(t, img, skip)
 	// cleanup the network (will be called last due to LIFO)
 	t.Cleanup(cleanupNetwork(t, cli, network))
 
 	hosts := make([]iago.Host, n)
 	for i := range n {
-		id, addr := createContainer(t, cli, network, signer)
+		id, addr := createContainer(t, cli, network, img, signer)
 		t.Cleanup(cleanupContainer(t, cli, network, id))
 		t.Logf("Created container %s with ssh address %s", id, addr)
 
@@ -106,14 +124,14 @@ func createClient(t testing.TB) *container.Container {
 	return cli
 }
 
-func buildImage(t testing.TB, cli *container.Container) {
-	buildCtx, err := prepareBuildContext()
+func buildImage(t testing.TB, cli *container.Container, img image) {
+	buildCtx, err := prepareBuildContext(img)
 	if err != nil {
 		t.Fatal(err)
 	}
 	res, err := cli.ImageBuild(context.Background(), buildCtx, build.ImageBuildOptions{
 		Dockerfile: "Dockerfile",
-		Tags:       []string{tag},
+		Tags:       []string{img.tag},
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -128,10 +146,10 @@ func buildImage(t testing.TB, cli *container.Container) {
 	}
 }
 
-func createContainer(t testing.TB, cli *container.Container, networkID string, signer ssh.Signer) (name, addr string) {
+func createContainer(t testing.TB, cli *container.Container, networkID string, img image, signer ssh.Signer) (name, addr string) {
 	res, err := cli.ContainerCreate(context.Background(), &container.Config{
 		Env:   []string{"AUTHORIZED_KEYS=" + string(ssh.MarshalAuthorizedKey(signer.PublicKey()))},
-		Image: tag,
+		Image: img.tag,
 		ExposedPorts: container.PortSet{
 			"22/tcp": struct{}{},
 		},
@@ -213,13 +231,13 @@ func createNetwork(t testing.TB, cli *container.Container) string {
 	return res.ID
 }
 
-func prepareBuildContext() (r io.ReadCloser, err error) {
+func prepareBuildContext(img image) (r io.ReadCloser, err error) {
 	var buf bytes.Buffer
 	tarWriter := tar.NewWriter(&buf)
 
 	err = tarWriter.WriteHeader(&tar.Header{
 		Name:   "Dockerfile",
-		Size:   int64(len(dockerfile)),
+		Size:   int64(len(img.dockerfile)),
 		Mode:   0o644,
 		Format: tar.FormatUSTAR,
 	})
@@ -227,7 +245,7 @@ func prepareBuildContext() (r io.ReadCloser, err error) {
 		return nil, err
 	}
 
-	_, err = tarWriter.Write(dockerfile)
+	_, err = tarWriter.Write(img.dockerfile)
 	if err != nil {
 		return nil, err
 	}
@@ -284,6 +302,12 @@ func setupSSHKeys(t testing.TB, tmpDir string) sshKeyFiles {
 // Returns the client and network ID for use in tests.
 // If skip is true, it will skip the test if the Docker daemon is not reachable.
 func setupContainerEnvironment(t testing.TB, skip bool) (*container.Container, string) {
+	t.Helper()
+	return setupImageEnvironment(t, alpineImage, skip)
+}
+
+// setupImageEnvironment is like setupContainerEnvironment, but builds img.
+func setupImageEnvironment(t testing.TB, img image, skip bool) (*container.Container, string) {
 	t.Helper()
 	cli := createClient(t)
 	if err := cli.Ping(context.Background()); err != nil {
@@ -293,7 +317,7 @@ func setupContainerEnvironment(t testing.TB, skip bool) (*container.Container, s
 			t.Fatal(err)
 		}
 	}
-	buildImage(t, cli)
+	buildImage(t, cli, img)
 
 	network := createNetwork(t, cli)
 	t.Logf("Created network %s", network)
@@ -312,7 +336,7 @@ type containerInfo struct {
 // createContainerWithInfo creates a container and returns structured information about it
 func createContainerWithInfo(t testing.TB, cli *container.Container, network, hostAlias string, signer ssh.Signer) containerInfo {
 	t.Helper()
-	id, addr := createContainer(t, cli, network, signer)
+	id, addr := createContainer(t, cli, network, alpineImage, signer)
 
 	_, port, err := net.SplitHostPort(addr)
 	if err != nil {
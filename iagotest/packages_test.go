@@ -0,0 +1,124 @@
+package iagotest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relab/iago"
+)
+
+// TestPackages exercises package detection and idempotent install and
+// removal against the Alpine test image, which uses apk.
+func TestPackages(t *testing.T) {
+	g := CreateSSHGroup(t, 1, true)
+	host := g.Hosts[0]
+	ctx := context.Background()
+
+	manager, err := iago.DetectPackageManager(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager != iago.Apk {
+		t.Fatalf("DetectPackageManager() = %q, want %q", manager, iago.Apk)
+	}
+
+	install := iago.Packages{Names: []string{"tree"}, Update: true}
+	changed, err := install.Ensure(ctx, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"tree"}) {
+		t.Errorf("first Ensure() changed = %q, want [tree]", changed)
+	}
+	if changed, err = install.Ensure(ctx, host); err != nil || len(changed) != 0 {
+		t.Errorf("second Ensure() = %q, %v, want no change", changed, err)
+	}
+	if _, err := iago.Output(ctx, host, "tree --version"); err != nil {
+		t.Errorf("tree is not installed: %v", err)
+	}
+
+	remove := iago.Packages{Names: []string{"tree"}, Remove: true}
+	changed, err = remove.Ensure(ctx, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"tree"}) {
+		t.Errorf("Ensure() with Remove changed = %q, want [tree]", changed)
+	}
+	if changed, err = remove.Ensure(ctx, host); err != nil || len(changed) != 0 {
+		t.Errorf("second Ensure() with Remove = %q, %v, want no change", changed, err)
+	}
+
+}
+
+// TestPackagesApt exercises apt against the Debian test image, including pins
+// of gawk, whose version carries an epoch, with and without the epoch, both
+// for the installed package and to install it.
+func TestPackagesApt(t *testing.T) {
+	g := createSSHGroup(t, debianImage, 1, true)
+	host := g.Hosts[0]
+	ctx := context.Background()
+
+	manager, err := iago.DetectPackageManager(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager != iago.Apt {
+		t.Fatalf("DetectPackageManager() = %q, want %q", manager, iago.Apt)
+	}
+
+	install := iago.Packages{Names: []string{"gawk"}, Update: true}
+	changed, err := install.Ensure(ctx, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"gawk"}) {
+		t.Errorf("first Ensure() changed = %q, want [gawk]", changed)
+	}
+	if changed, err = install.Ensure(ctx, host); err != nil || len(changed) != 0 {
+		t.Errorf("second Ensure() = %q, %v, want no change", changed, err)
+	}
+
+	out, err := iago.Output(ctx, host, "dpkg-query -W -f='${Version}' gawk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version := strings.TrimSpace(out)
+	_, withoutEpoch, ok := strings.Cut(version, ":")
+	if !ok {
+		t.Fatalf("gawk version %q has no epoch", version)
+	}
+	for _, pin := range []string{version, withoutEpoch} {
+		pinned := iago.Packages{Names: []string{"gawk=" + pin}}
+		if changed, err = pinned.Ensure(ctx, host); err != nil || len(changed) != 0 {
+			t.Errorf("Ensure() with pin %q = %q, %v, want no change", pin, changed, err)
+		}
+	}
+
+	remove := iago.Packages{Names: []string{"gawk"}, Remove: true}
+	changed, err = remove.Ensure(ctx, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"gawk"}) {
+		t.Errorf("Ensure() with Remove changed = %q, want [gawk]", changed)
+	}
+	if changed, err = remove.Ensure(ctx, host); err != nil || len(changed) != 0 {
+		t.Errorf("second Ensure() with Remove = %q, %v, want no change", changed, err)
+	}
+
+	// A missing package is installed from a pin without the epoch.
+	pinned := iago.Packages{Names: []string{"gawk=" + withoutEpoch}}
+	changed, err = pinned.Ensure(ctx, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, pinned.Names) {
+		t.Errorf("Ensure() with pin %q changed = %q, want %q", withoutEpoch, changed, pinned.Names)
+	}
+	if out, err = iago.Output(ctx, host, "dpkg-query -W -f='${Version}' gawk"); err != nil || strings.TrimSpace(out) != version {
+		t.Errorf("gawk version after pinned install = %q, %v, want %q", strings.TrimSpace(out), err, version)
+	}
+}
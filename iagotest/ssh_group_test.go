@@ -287,6 +287,72 @@ func TestNewSSHGroupProxyJump(t *testing.T) {
 	})
 }
 
+// TestNewSSHGroupProxyJumpChain verifies that NewSSHGroup dials targets
+// through a two-hop ProxyJump chain, given either as a comma-separated list or
+// through a jump host with its own ProxyJump, and that both forms share the
+// connections to both hops.
+func TestNewSSHGroupProxyJumpChain(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyFiles := setupSSHKeys(t, tmpDir)
+
+	cli, network := setupContainerEnvironment(t, true)
+	t.Cleanup(cleanupNetwork(t, cli, network))
+
+	outer := createContainerWithInfo(t, cli, network, "outer", keyFiles.signer)
+	t.Cleanup(cleanupContainer(t, cli, network, outer.id))
+	inner := createContainerWithInfo(t, cli, network, "inner", keyFiles.signer)
+	t.Cleanup(cleanupContainer(t, cli, network, inner.id))
+	listed := createContainerWithInfo(t, cli, network, "target-listed", keyFiles.signer)
+	t.Cleanup(cleanupContainer(t, cli, network, listed.id))
+	nested := createContainerWithInfo(t, cli, network, "target-nested", keyFiles.signer)
+	t.Cleanup(cleanupContainer(t, cli, network, nested.id))
+
+	proxy := newCountingProxy(t, outer.address)
+	_, proxyPort, err := net.SplitHostPort(proxy.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	internalEntry := func(alias, id, proxyJump string) string {
+		return fmt.Sprintf(`Host %s
+	Hostname %s
+	User root
+	IdentityFile %s
+	Port 22
+	ProxyJump %s
+	StrictHostKeyChecking no
+	UserKnownHostsFile /dev/null
+`, alias, id, keyFiles.privateKeyPath, proxyJump)
+	}
+	configPath := filepath.Join(tmpDir, "config")
+	createSSHConfigFile(t, configPath, []string{
+		sshConfigEntry(outer.hostAlias, "127.0.0.1", "root", keyFiles.privateKeyPath, proxyPort),
+		internalEntry(inner.hostAlias, inner.id, outer.hostAlias),
+		internalEntry(listed.hostAlias, listed.id, outer.hostAlias+","+inner.hostAlias),
+		internalEntry(nested.hostAlias, nested.id, inner.hostAlias),
+	})
+
+	group, err := iago.NewSSHGroup([]string{listed.hostAlias, nested.hostAlias}, configPath, iago.FailFast())
+	if err != nil {
+		t.Fatalf("NewSSHGroup: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := group.Close(); err != nil {
+			t.Errorf("group.Close: %v", err)
+		}
+	})
+
+	if n := proxy.accepted.Load(); n != 1 {
+		t.Errorf("outer jump host dialed %d times, want 1 (shared connection not reused)", n)
+	}
+
+	group.ErrorHandler = func(e error) { t.Error(e) }
+	group.Run("hostname via chain", func(ctx context.Context, host iago.Host) error {
+		var sb strings.Builder
+		return (iago.Shell{Command: "hostname", Stdout: &sb}).Apply(ctx, host)
+	})
+}
+
 func TestNewSSHGroupPartialDialErrors(t *testing.T) {
 	tmpDir := t.TempDir()
 	keyFiles := setupSSHKeys(t, tmpDir)
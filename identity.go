@@ -0,0 +1,170 @@
+package iago
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// PassphraseCallback returns the passphrase that decrypts the private key in
+// file, an IdentityFile of the SSH config.
+type PassphraseCallback func(file string) ([]byte, error)
+
+// Passphrase returns a [GroupOption] that lets [NewSSHGroup] use
+// passphrase-protected private keys, decrypted with the passphrase returned
+// by callback. The callback is called at most once for each file, when the
+// key is first needed and not already held by the SSH agent, and the key is
+// shared by all hosts using the same file. [PassphraseFromEnv] and
+// [PassphrasePrompt] provide common callbacks.
+func Passphrase(callback PassphraseCallback) GroupOption {
+	return func(cfg *groupConfig) {
+		cfg.passphrase = callback
+	}
+}
+
+// PassphraseFromEnv returns a [PassphraseCallback] that reads the passphrase
+// from the environment variable name, failing if it is not set.
+func PassphraseFromEnv(name string) PassphraseCallback {
+	return func(string) ([]byte, error) {
+		passphrase, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s not set", name)
+		}
+		return []byte(passphrase), nil
+	}
+}
+
+// PassphrasePrompt returns a [PassphraseCallback] that asks for the
+// passphrase on the terminal, like ssh(1). Standard input must be a terminal.
+func PassphrasePrompt() PassphraseCallback {
+	return func(file string) ([]byte, error) {
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return nil, errors.New("passphrase prompt requires a terminal on standard input")
+		}
+		fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", file)
+		defer fmt.Fprintln(os.Stderr)
+		return term.ReadPassword(fd)
+	}
+}
+
+// keyCache holds the private keys loaded from IdentityFiles, so that each
+// file is read, and its passphrase asked for, once for all hosts.
+type keyCache struct {
+	mu   sync.Mutex
+	keys map[string]ssh.Signer // nil for a missing key or one held by the agent
+}
+
+// publicKeySigners returns the signers with which user authenticates by
+// public key: the valid user certificates of the SSH agent and of
+// certificateFiles, followed by the other keys of the agent and the private
+// key in identityFile. Keys and certificates that cannot be used are left out,
+// since the host may still authenticate by other means, and returned as the
+// error.
+func (c *keyCache) publicKeySigners(identityFile string, certFiles []string, user string, passphrase PassphraseCallback) ([]ssh.Signer, error) {
+	agentKeys := agentSigners()
+	now := time.Now()
+	var certs, keys []ssh.Signer
+	var errs []error
+	for _, signer := range agentKeys {
+		cert, ok := signer.PublicKey().(*ssh.Certificate)
+		if !ok {
+			keys = append(keys, signer)
+			continue
+		}
+		if err := checkCertificate(cert, user, now); err != nil {
+			errs = append(errs, fmt.Errorf("ssh-agent: %w", err))
+			continue
+		}
+		certs = append(certs, signer)
+	}
+	signer, err := c.signer(identityFile, agentKeys, passphrase)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if signer != nil {
+		keys = append(keys, signer)
+	}
+	for _, file := range certificateFiles(identityFile, certFiles) {
+		signer, err := certSigner(file, keys, user, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		certs = append(certs, signer)
+	}
+	return append(certs, keys...), errors.Join(errs...)
+}
+
+// signer returns the signer for the private key in file, loading it with
+// loadIdentity on first use. The lock is held while loading, so that
+// concurrent dials ask for a passphrase only once. Failures are not cached,
+// so that a mistyped passphrase is asked for again by the next dial.
+func (c *keyCache) signer(file string, agentSigners []ssh.Signer, passphrase PassphraseCallback) (ssh.Signer, error) {
+	file = expand(file)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if signer, ok := c.keys[file]; ok {
+		return signer, nil
+	}
+	signer, err := loadIdentity(file, agentSigners, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if c.keys == nil {
+		c.keys = make(map[string]ssh.Signer)
+	}
+	c.keys[file] = signer
+	return signer, nil
+}
+
+// loadIdentity returns a signer for the private key in file. It returns nil
+// and no error if the file does not exist, or if the key is passphrase
+// protected and the SSH agent holds it already. A protected key is decrypted
+// with the passphrase from passphrase, if not nil.
+func loadIdentity(file string, agentSigners []ssh.Signer, passphrase PassphraseCallback) (ssh.Signer, error) {
+	buffer, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(buffer)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity file %s: %w", file, err)
+		}
+		return signer, nil
+	}
+	if missing.PublicKey != nil {
+		for _, s := range agentSigners {
+			if keysEqual(s.PublicKey(), missing.PublicKey) {
+				return nil, nil
+			}
+		}
+	}
+	if passphrase == nil {
+		return nil, fmt.Errorf("identity file %s is passphrase protected: add it to ssh-agent or use the Passphrase option", file)
+	}
+	pass, err := passphrase(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passphrase for identity file %s: %w", file, err)
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(buffer, pass)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt identity file %s: %w", file, err)
+	}
+	return signer, nil
+}
+
+func keysEqual(a, b ssh.PublicKey) bool {
+	return string(a.Marshal()) == string(b.Marshal())
+}
@@ -0,0 +1,175 @@
+package iago
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// writeProtectedIdentity writes a new private key encrypted with passphrase
+// to a file and returns its path and signer.
+func writeProtectedIdentity(t *testing.T, passphrase string) (string, ssh.Signer) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file, signer
+}
+
+func TestLoadIdentity(t *testing.T) {
+	plain := writeIdentity(t)
+	protected, signer := writeProtectedIdentity(t, "open sesame")
+	garbage := filepath.Join(t.TempDir(), "garbage")
+	if err := os.WriteFile(garbage, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	passphrase := func(p string) PassphraseCallback {
+		return func(string) ([]byte, error) { return []byte(p), nil }
+	}
+
+	tests := []struct {
+		name       string
+		file       string
+		agent      []ssh.Signer
+		passphrase PassphraseCallback
+		wantSigner bool
+		wantErr    string
+	}{
+		{name: "Plain", file: plain, wantSigner: true},
+		{name: "Missing", file: filepath.Join(t.TempDir(), "missing")},
+		{name: "Garbage", file: garbage, wantErr: "failed to parse identity file " + garbage},
+		{name: "ProtectedNoCallback", file: protected, wantErr: "identity file " + protected + " is passphrase protected"},
+		{name: "ProtectedInAgent", file: protected, agent: []ssh.Signer{signer}},
+		{name: "Passphrase", file: protected, passphrase: passphrase("open sesame"), wantSigner: true},
+		{name: "WrongPassphrase", file: protected, passphrase: passphrase("guess"), wantErr: "failed to decrypt identity file " + protected},
+		{
+			name:       "CallbackError",
+			file:       protected,
+			passphrase: func(string) ([]byte, error) { return nil, errors.New("no terminal") },
+			wantErr:    "failed to get passphrase for identity file " + protected + ": no terminal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadIdentity(tt.file, tt.agent, tt.passphrase)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadIdentity() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadIdentity() error = %v", err)
+			}
+			if (got != nil) != tt.wantSigner {
+				t.Errorf("loadIdentity() = %v, want signer %v", got, tt.wantSigner)
+			}
+			if got != nil && tt.file == protected && !keysEqual(got.PublicKey(), signer.PublicKey()) {
+				t.Error("decrypted key does not match the protected key")
+			}
+		})
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	file, _ := writeProtectedIdentity(t, "open sesame")
+	var asked []string
+	passphrase := func(file string) ([]byte, error) {
+		asked = append(asked, file)
+		return []byte("open sesame"), nil
+	}
+	var c keyCache
+	first, err := c.signer(file, nil, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.signer(file, nil, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("signer() loaded the key twice")
+	}
+	if len(asked) != 1 || asked[0] != file {
+		t.Errorf("passphrase asked for %q, want once for %s", asked, file)
+	}
+
+	// A wrong passphrase is not cached: the next dial asks again.
+	other, _ := writeProtectedIdentity(t, "open sesame")
+	typo := func(string) ([]byte, error) { return []byte("open sesam"), nil }
+	if _, err := c.signer(other, nil, typo); err == nil {
+		t.Fatal("signer() with a wrong passphrase succeeded")
+	}
+	if _, err := c.signer(other, nil, passphrase); err != nil {
+		t.Errorf("signer() after a wrong passphrase error = %v, want the key", err)
+	}
+}
+
+func TestPassphraseFromEnv(t *testing.T) {
+	t.Setenv("IAGO_TEST_PASSPHRASE", "open sesame")
+	got, err := PassphraseFromEnv("IAGO_TEST_PASSPHRASE")("id_ed25519")
+	if err != nil || !bytes.Equal(got, []byte("open sesame")) {
+		t.Errorf("PassphraseFromEnv() = %q, %v, want %q", got, err, "open sesame")
+	}
+	if _, err := PassphraseFromEnv("IAGO_TEST_UNSET")("id_ed25519"); err == nil {
+		t.Error("PassphraseFromEnv() of an unset variable succeeded")
+	}
+}
+
+func TestNewSSHGroupPassphrase(t *testing.T) {
+	identity, signer := writeProtectedIdentity(t, "open sesame")
+	srv := newTestServer(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !keysEqual(key, signer.PublicKey()) {
+				return nil, errors.New("unknown key")
+			}
+			return nil, nil
+		},
+	})
+	file := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(file, []byte(srv.configEntry("vm1", identity)+srv.configEntry("vm2", identity)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewSSHGroup([]string{"vm1"}, file, FailFast())
+	if err == nil || !strings.Contains(err.Error(), "passphrase protected") {
+		t.Errorf("NewSSHGroup() without passphrase error = %v, want passphrase protected", err)
+	}
+
+	var asked int
+	g, err := NewSSHGroup([]string{"vm1", "vm2"}, file, FailFast(), DialConcurrency(2), Passphrase(func(string) ([]byte, error) {
+		asked++
+		return []byte("open sesame"), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if len(g.Hosts) != 2 {
+		t.Errorf("group has %d hosts, want 2", len(g.Hosts))
+	}
+	if asked != 1 {
+		t.Errorf("passphrase asked %d times, want 1", asked)
+	}
+}
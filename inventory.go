@@ -0,0 +1,365 @@
+package iago
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// InventoryGroupsVar is the host variable in which [Inventory.NewSSHGroup]
+// stores the sorted names of the inventory groups a host belongs to, as a
+// []string.
+const InventoryGroupsVar = "iago.inventory.groups"
+
+// Inventory describes a set of hosts, organized in possibly nested groups,
+// and the variables of each host. Hosts are named by their alias in the SSH
+// config, which provides their connection details. In YAML:
+//
+//	vars:
+//	  experiment: paxos
+//	hosts:
+//	  replica1:
+//	    vars: {id: 1}
+//	  replica2:
+//	    vars: {id: 2}
+//	groups:
+//	  replicas:
+//	    hosts: [replica1, replica2]
+//	    vars: {role: replica}
+//	    groups:
+//	      leaders:
+//	        hosts: [replica1]
+//	        vars: {role: leader}
+//
+// The variables of a host are those of the inventory, overridden by those of
+// each group containing it from the outermost to the innermost, and finally
+// by its own. A host in a nested group is also a member of the enclosing
+// groups. Hosts listed in a group need not be listed under hosts.
+type Inventory struct {
+	// Vars are the variables of every host.
+	Vars map[string]any `yaml:"vars" toml:"vars" json:"vars"`
+	// Hosts maps host aliases to their definitions.
+	Hosts map[string]InventoryHost `yaml:"hosts" toml:"hosts" json:"hosts"`
+	// Groups maps group names to their definitions. Group names must be
+	// unique, also across nesting levels.
+	Groups map[string]InventoryGroup `yaml:"groups" toml:"groups" json:"groups"`
+}
+
+// InventoryHost is a host in an [Inventory].
+type InventoryHost struct {
+	// Vars are the variables of the host.
+	Vars map[string]any `yaml:"vars" toml:"vars" json:"vars"`
+}
+
+// InventoryGroup is a group of hosts in an [Inventory].
+type InventoryGroup struct {
+	// Hosts lists the aliases of the hosts in the group.
+	Hosts []string `yaml:"hosts" toml:"hosts" json:"hosts"`
+	// Vars are the variables of the hosts in the group.
+	Vars map[string]any `yaml:"vars" toml:"vars" json:"vars"`
+	// Groups maps the names of nested groups to their definitions.
+	Groups map[string]InventoryGroup `yaml:"groups" toml:"groups" json:"groups"`
+}
+
+// LoadInventory reads an [Inventory] from file, in YAML, TOML or JSON format
+// as given by its extension: .yaml or .yml, .toml, or .json.
+func LoadInventory(file string) (*Inventory, error) {
+	data, err := os.ReadFile(expand(file))
+	if err != nil {
+		return nil, fmt.Errorf("iago: failed to read inventory: %w", err)
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+	inv, err := ParseInventory(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("iago: %s: %w", file, err)
+	}
+	return inv, nil
+}
+
+// ParseInventory parses an [Inventory] from data in the given format: "yaml"
+// (or "yml"), "toml" or "json". Integer variables are decoded as int and other
+// numbers as float64 in every format. Unknown fields, such as a misspelled
+// "var:", are rejected in every format.
+func ParseInventory(data []byte, format string) (*Inventory, error) {
+	var inv Inventory
+	var err error
+	switch format {
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(&inv); errors.Is(err, io.EOF) {
+			err = nil // empty document
+		}
+	case "toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), &inv)
+		for _, key := range md.Undecoded() {
+			if err == nil && !inTOMLVars(key) {
+				err = fmt.Errorf("unknown field %q", key.String())
+			}
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&inv)
+	default:
+		return nil, fmt.Errorf("iago: unknown inventory format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("iago: failed to parse inventory: %w", err)
+	}
+	if err := inv.validate(); err != nil {
+		return nil, err
+	}
+	inv.normalize()
+	return &inv, nil
+}
+
+// validate checks that group names are unique and no name is empty.
+func (inv *Inventory) validate() error {
+	for name := range inv.Hosts {
+		if name == "" {
+			return fmt.Errorf("iago: inventory has a host with an empty name")
+		}
+	}
+	seen := make(map[string]bool)
+	var check func(groups map[string]InventoryGroup) error
+	check = func(groups map[string]InventoryGroup) error {
+		for name, group := range groups {
+			if name == "" {
+				return fmt.Errorf("iago: inventory has a group with an empty name")
+			}
+			if seen[name] {
+				return fmt.Errorf("iago: inventory group %q is defined more than once", name)
+			}
+			seen[name] = true
+			if slices.Contains(group.Hosts, "") {
+				return fmt.Errorf("iago: inventory group %q has a host with an empty name", name)
+			}
+			if err := check(group.Groups); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(inv.Groups)
+}
+
+// normalize converts the numbers of every variable to int or float64, which
+// the decoders otherwise represent as int64, uint64 or json.Number.
+func (inv *Inventory) normalize() {
+	normalizeVars(inv.Vars)
+	for _, host := range inv.Hosts {
+		normalizeVars(host.Vars)
+	}
+	inv.walk(func(_ string, group InventoryGroup, _ []string) {
+		normalizeVars(group.Vars)
+	})
+}
+
+func normalizeVars(vars map[string]any) {
+	for key, val := range vars {
+		vars[key] = normalizeValue(val)
+	}
+}
+
+func normalizeValue(val any) any {
+	switch v := val.(type) {
+	case int64:
+		if v >= math.MinInt && v <= math.MaxInt {
+			return int(v)
+		}
+	case uint64:
+		if v <= math.MaxInt {
+			return int(v)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return normalizeValue(i)
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case []any:
+		for i := range v {
+			v[i] = normalizeValue(v[i])
+		}
+	case []map[string]any:
+		// A TOML array of tables, decoded as []any like in the other formats.
+		s := make([]any, len(v))
+		for i := range v {
+			s[i] = normalizeValue(v[i])
+		}
+		return s
+	case map[string]any:
+		normalizeVars(v)
+	}
+	return val
+}
+
+// inTOMLVars reports whether key lies inside a vars table of the inventory,
+// whose keys are variables rather than fields. TOML reports the keys of a
+// table decoded into a map[string]any as undecoded.
+func inTOMLVars(key toml.Key) bool {
+	for i := 0; i < len(key); i += 2 {
+		switch {
+		case key[i] == "vars":
+			return true
+		case (key[i] == "hosts" || key[i] == "groups") && i+2 < len(key):
+			// The next key names the host or group.
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// walk calls fn for every group, outermost first and in name order among
+// siblings, with the names of the groups enclosing it.
+func (inv *Inventory) walk(fn func(name string, group InventoryGroup, parents []string)) {
+	var visit func(groups map[string]InventoryGroup, parents []string)
+	visit = func(groups map[string]InventoryGroup, parents []string) {
+		for _, name := range slices.Sorted(maps.Keys(groups)) {
+			fn(name, groups[name], parents)
+			visit(groups[name].Groups, append(slices.Clip(parents), name))
+		}
+	}
+	visit(inv.Groups, nil)
+}
+
+// memberships returns, for each host, the names of the groups it belongs to,
+// outermost first.
+func (inv *Inventory) memberships() map[string][]string {
+	members := make(map[string][]string)
+	inv.walk(func(name string, group InventoryGroup, parents []string) {
+		for _, host := range group.Hosts {
+			for _, g := range append(slices.Clip(parents), name) {
+				if !slices.Contains(members[host], g) {
+					members[host] = append(members[host], g)
+				}
+			}
+		}
+	})
+	return members
+}
+
+// HostNames returns the sorted aliases of the hosts in group, including those
+// in its nested groups, or of every host in the inventory if group is empty.
+func (inv *Inventory) HostNames(group string) ([]string, error) {
+	names := make(map[string]bool)
+	found := group == ""
+	if group == "" {
+		for name := range inv.Hosts {
+			names[name] = true
+		}
+	}
+	for host, groups := range inv.memberships() {
+		if group == "" || slices.Contains(groups, group) {
+			names[host] = true
+		}
+	}
+	if !found {
+		inv.walk(func(name string, _ InventoryGroup, _ []string) {
+			found = found || name == group
+		})
+	}
+	if !found {
+		return nil, fmt.Errorf("iago: inventory has no group %q", group)
+	}
+	return slices.Sorted(maps.Keys(names)), nil
+}
+
+// VarsFor returns the variables of host, resolved as described by
+// [Inventory], including [InventoryGroupsVar]. Maps and slices in the
+// variables are copied, so that hosts do not share them.
+func (inv *Inventory) VarsFor(host string) map[string]any {
+	vars := make(map[string]any)
+	copyVars(vars, inv.Vars)
+	groups := inv.memberships()[host]
+	// Groups are applied in walk order, so that nested groups override the
+	// groups enclosing them.
+	inv.walk(func(name string, group InventoryGroup, _ []string) {
+		if slices.Contains(groups, name) {
+			copyVars(vars, group.Vars)
+		}
+	})
+	copyVars(vars, inv.Hosts[host].Vars)
+	vars[InventoryGroupsVar] = slices.Sorted(slices.Values(groups))
+	return vars
+}
+
+// NewSSHGroup dials the hosts of group, or every host if group is empty, as
+// [NewSSHGroup] does with the connection details in sshConfigFile, and seeds
+// the variables of each host from the inventory. Variables given with a
+// [HostVars] option in opts take precedence.
+func (inv *Inventory) NewSSHGroup(group, sshConfigFile string, opts ...GroupOption) (Group, error) {
+	names, err := inv.HostNames(group)
+	if err != nil {
+		return Group{}, err
+	}
+	vars := make(map[string]map[string]any, len(names))
+	for _, name := range names {
+		vars[name] = inv.VarsFor(name)
+	}
+	// The inventory's variables are applied first, and merged with those of
+	// any HostVars option given by the caller.
+	return NewSSHGroup(names, sshConfigFile, append([]GroupOption{inventoryVars(vars)}, opts...)...)
+}
+
+// inventoryVars returns a [GroupOption] that seeds host variables from an
+// inventory, beneath any variables set by a later [HostVars] option.
+func inventoryVars(vars map[string]map[string]any) GroupOption {
+	return func(cfg *groupConfig) {
+		cfg.inventoryVars = vars
+	}
+}
+
+// copyVars copies the variables in src to dst, deep-copying their values.
+func copyVars(dst, src map[string]any) {
+	for key, val := range src {
+		dst[key] = copyValue(val)
+	}
+}
+
+// copyValue returns a deep copy of the maps and slices that the inventory
+// formats decode into; other values are returned as is.
+func copyValue(val any) any {
+	switch v := val.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		copyVars(m, v)
+		return m
+	case map[any]any:
+		m := make(map[any]any, len(v))
+		for key, elem := range v {
+			m[key] = copyValue(elem)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, elem := range v {
+			s[i] = copyValue(elem)
+		}
+		return s
+	case []map[string]any:
+		s := make([]map[string]any, len(v))
+		for i, elem := range v {
+			s[i] = copyValue(elem).(map[string]any)
+		}
+		return s
+	}
+	return val
+}
@@ -0,0 +1,105 @@
+package iago
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestLoadInventory(t *testing.T) {
+	for _, file := range []string{"testdata/inventory.yaml", "testdata/inventory.toml", "testdata/inventory.json"} {
+		t.Run(file, func(t *testing.T) {
+			inv, err := LoadInventory(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hostTests := []struct {
+				group string
+				want  []string
+			}{
+				{group: "", want: []string{"client1", "replica1", "replica2", "replica3"}},
+				{group: "replicas", want: []string{"replica1", "replica2", "replica3"}},
+				{group: "leaders", want: []string{"replica1"}},
+				{group: "clients", want: []string{"client1"}},
+			}
+			for _, tt := range hostTests {
+				got, err := inv.HostNames(tt.group)
+				if err != nil {
+					t.Fatalf("HostNames(%q) error = %v", tt.group, err)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("HostNames(%q) = %q, want %q", tt.group, got, tt.want)
+				}
+			}
+			if _, err := inv.HostNames("missing"); err == nil {
+				t.Error("HostNames(missing) succeeded, want error")
+			}
+
+			varTests := []struct {
+				host string
+				want map[string]any
+			}{
+				{host: "replica1", want: map[string]any{
+					"experiment": "paxos", "replicas": 3, "id": 1, "role": "leader",
+					"ports": []any{8080, 8081}, InventoryGroupsVar: []string{"leaders", "replicas"},
+				}},
+				{host: "replica3", want: map[string]any{
+					"experiment": "paxos", "replicas": 3, "role": "replica",
+					"ports": []any{8080, 8081}, InventoryGroupsVar: []string{"replicas"},
+				}},
+				{host: "client1", want: map[string]any{
+					"experiment": "paxos", "replicas": 3, "rate": 0.5, "role": "client",
+					"db": map[string]any{"port": 5432}, "targets": []any{map[string]any{"port": 80}},
+					InventoryGroupsVar: []string{"clients"},
+				}},
+			}
+			for _, tt := range varTests {
+				if got := inv.VarsFor(tt.host); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("VarsFor(%s) = %#v, want %#v", tt.host, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInventoryErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+	}{
+		{name: "UnknownFormat", data: "{}", format: "ini"},
+		{name: "Syntax", data: "hosts: [", format: "yaml"},
+		{name: "UnknownJSONField", data: `{"host": {}}`, format: "json"},
+		{name: "UnknownYAMLField", data: "hosts:\n  a:\n    var: {id: 1}\n", format: "yaml"},
+		{name: "UnknownTOMLField", data: "[hosts.a.var]\nid = 1\n", format: "toml"},
+		{name: "UnknownTOMLGroupField", data: "[groups.a.groups.b.host]\nid = 1\n", format: "toml"},
+		{name: "DuplicateGroup", data: "groups:\n  a:\n    groups:\n      b: {}\n  b: {}\n", format: "yaml"},
+		{name: "EmptyHostInGroup", data: "groups:\n  a:\n    hosts: ['']\n", format: "yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseInventory([]byte(tt.data), tt.format); err == nil {
+				t.Errorf("ParseInventory(%q) succeeded, want error", tt.data)
+			}
+		})
+	}
+}
+
+func TestVarsForCopiesValues(t *testing.T) {
+	inv, err := ParseInventory([]byte("vars:\n  ports: [80]\n  limits: {cpu: 1}\nhosts:\n  a: {}\n  b: {}\n"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := inv.VarsFor("a")
+	a["ports"].([]any)[0] = 443
+	a["limits"].(map[string]any)["cpu"] = 2
+	b := inv.VarsFor("b")
+	if got := b["ports"].([]any)[0]; got != 80 {
+		t.Errorf("ports[0] of b = %v, want 80", got)
+	}
+	if got := b["limits"].(map[string]any)["cpu"]; got != 1 {
+		t.Errorf("limits.cpu of b = %v, want 1", got)
+	}
+}
@@ -0,0 +1,123 @@
+package iago
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Markers of known_hosts entries, as described in sshd(8).
+const (
+	markerCertAuthority = "@cert-authority"
+	markerRevoked       = "@revoked"
+)
+
+// hostCertAlgorithms are the host certificate algorithms requested, before
+// the host's plain key types, when a @cert-authority entry matches the host.
+// Security key certificates are left out, since the SSH client does not
+// support them as host key algorithms.
+var hostCertAlgorithms = []string{
+	ssh.CertAlgoED25519v01,
+	ssh.CertAlgoECDSA521v01,
+	ssh.CertAlgoECDSA384v01,
+	ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoRSASHA512v01,
+	ssh.CertAlgoRSASHA256v01,
+}
+
+// matchKnownHost reports whether host, normalized by [knownhosts.Normalize],
+// matches the comma-separated patterns of a known_hosts entry. A pattern may
+// be hashed, contain the wildcards * and ?, or be negated with !, in which
+// case a match rules out the host whatever the other patterns say.
+func matchKnownHost(patterns, host string) bool {
+	matched := false
+	for pattern := range strings.SplitSeq(patterns, ",") {
+		if strings.HasPrefix(pattern, "|1|") {
+			matched = matched || matchesHashedHost(pattern, host)
+			continue
+		}
+		negated := strings.HasPrefix(pattern, "!")
+		if !matchWildcard(strings.TrimPrefix(pattern, "!"), host) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchWildcard reports whether s matches pattern, where * matches any
+// sequence of characters and ? matches any single character.
+func matchWildcard(pattern, s string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if matchWildcard(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return s == ""
+}
+
+// revokedKeys returns the keys of the @revoked entries in files, keyed by
+// their wire encoding. Entries that cannot be parsed are skipped; they are
+// reported by [knownhosts.New].
+func revokedKeys(files []string) map[string]knownhosts.KnownKey {
+	revoked := make(map[string]knownhosts.KnownKey)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		lineNum := 0
+		for line := range strings.Lines(string(data)) {
+			lineNum++
+			if !strings.HasPrefix(strings.TrimSpace(line), markerRevoked) {
+				continue
+			}
+			_, _, key, _, _, err := ssh.ParseKnownHosts([]byte(line))
+			if err != nil {
+				continue
+			}
+			revoked[string(key.Marshal())] = knownhosts.KnownKey{Key: key, Filename: file, Line: lineNum}
+		}
+	}
+	return revoked
+}
+
+// checkRevoked returns a [knownhosts.RevokedError] if key is revoked. For a
+// host certificate, the certified key and the signing authority are checked
+// too, which [knownhosts.New] does not do.
+func checkRevoked(revoked map[string]knownhosts.KnownKey, key ssh.PublicKey) error {
+	keys := []ssh.PublicKey{key}
+	if cert, ok := key.(*ssh.Certificate); ok {
+		keys = append(keys, cert.Key, cert.SignatureKey)
+	}
+	for _, k := range keys {
+		if known, ok := revoked[string(k.Marshal())]; ok {
+			return &knownhosts.RevokedError{Revoked: known}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package iago
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestMatchKnownHost(t *testing.T) {
+	tests := []struct {
+		patterns string
+		host     string
+		want     bool
+	}{
+		{patterns: "db.example.com", host: "db.example.com", want: true},
+		{patterns: "db.example.com", host: "web.example.com", want: false},
+		{patterns: "*.example.com", host: "db.example.com", want: true},
+		{patterns: "*.example.com", host: "example.com", want: false},
+		{patterns: "db?.example.com", host: "db1.example.com", want: true},
+		{patterns: "db?.example.com", host: "db10.example.com", want: false},
+		{patterns: "*", host: "[db.example.com]:2222", want: true},
+		{patterns: "*.example.com", host: "[db.example.com]:2222", want: false},
+		{patterns: "[*.example.com]:2222", host: "[db.example.com]:2222", want: true},
+		{patterns: "*.example.com,!legacy.example.com", host: "legacy.example.com", want: false},
+		{patterns: "!legacy.example.com,*.example.com", host: "db.example.com", want: true},
+		{patterns: "!legacy.example.com", host: "db.example.com", want: false},
+		{patterns: "web,db", host: "db", want: true},
+	}
+	for _, tt := range tests {
+		if got := matchKnownHost(tt.patterns, tt.host); got != tt.want {
+			t.Errorf("matchKnownHost(%q, %q) = %v, want %v", tt.patterns, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestHostCertificate(t *testing.T) {
+	ca := newTestSigner(t)
+	hostKey := newTestSigner(t)
+	cert := &ssh.Certificate{
+		Key:             hostKey.PublicKey(),
+		KeyId:           "test host",
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"127.0.0.1"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(certSigner)
+	srv := newTestServer(t, config)
+	host, port, _ := net.SplitHostPort(srv.addr)
+	authority := "@cert-authority " + knownhosts.Normalize(srv.addr) + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey())))
+
+	tests := []struct {
+		name       string
+		knownHosts []string
+		wantErr    string
+	}{
+		{name: "TrustedAuthority", knownHosts: []string{authority}},
+		{name: "UnknownAuthority", knownHosts: []string{"other-host " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey())))}, wantErr: "no authorities"},
+		{name: "RevokedAuthority", knownHosts: []string{authority, "@revoked * " + string(ssh.MarshalAuthorizedKey(ca.PublicKey()))}, wantErr: "revoked"},
+		{name: "RevokedHostKey", knownHosts: []string{authority, "@revoked * " + string(ssh.MarshalAuthorizedKey(hostKey.PublicKey()))}, wantErr: "revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			knownHostsFile := filepath.Join(dir, "known_hosts")
+			if err := os.WriteFile(knownHostsFile, []byte(strings.Join(tt.knownHosts, "\n")+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join(dir, "config")
+			content := fmt.Sprintf("Host server\n    Hostname %s\n    Port %s\n    User test\n    IdentityFile %s\n    UserKnownHostsFile %s\n    StrictHostKeyChecking yes\n",
+				host, port, writeIdentity(t), knownHostsFile)
+			if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			g, err := NewSSHGroup([]string{"server"}, file, FailFast())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = g.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewSSHGroup() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckRevoked(t *testing.T) {
+	ca, hostKey, other := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	cert := &ssh.Certificate{Key: hostKey.PublicKey(), CertType: ssh.HostCert, ValidBefore: ssh.CertTimeInfinity}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	revoked := func(keys ...ssh.Signer) map[string]knownhosts.KnownKey {
+		m := make(map[string]knownhosts.KnownKey)
+		for _, k := range keys {
+			m[string(k.PublicKey().Marshal())] = knownhosts.KnownKey{Key: k.PublicKey(), Filename: "known_hosts", Line: 1}
+		}
+		return m
+	}
+	for _, tt := range []struct {
+		name    string
+		revoked map[string]knownhosts.KnownKey
+		key     ssh.PublicKey
+		want    bool
+	}{
+		{name: "PlainKey", revoked: revoked(hostKey), key: hostKey.PublicKey(), want: true},
+		{name: "CertifiedKey", revoked: revoked(hostKey), key: cert, want: true},
+		{name: "Authority", revoked: revoked(ca), key: cert, want: true},
+		{name: "Other", revoked: revoked(other), key: cert, want: false},
+	} {
+		err := checkRevoked(tt.revoked, tt.key)
+		var revokedErr *knownhosts.RevokedError
+		if got := errors.As(err, &revokedErr); got != tt.want {
+			t.Errorf("%s: checkRevoked() error = %v, want revoked %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package iago
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+)
+
+// Stream identifies the standard stream that a line of output was written to.
+type Stream string
+
+const (
+	// StdoutStream is a command's standard output.
+	StdoutStream Stream = "stdout"
+	// StderrStream is a command's standard error.
+	StderrStream Stream = "stderr"
+)
+
+// LineFunc is called by a [LineWriter] with each line of output written to it,
+// without the trailing newline.
+type LineFunc func(host string, stream Stream, line string)
+
+// LineWriter is an [io.Writer] that splits the output of a command into lines
+// and passes each complete line to a [LineFunc]. Use it as [Shell.Stdout] or
+// [Shell.Stderr] to consume output line by line as it arrives:
+//
+//	iago.Shell{
+//		Command: "make",
+//		Stdout: iago.NewLineWriter(host, iago.StdoutStream, func(host string, _ iago.Stream, line string) {
+//			progress.Update(host, line)
+//		}),
+//	}
+//
+// A final line without a trailing newline is held back until [LineWriter.Flush],
+// which [Shell] calls when the command completes. A LineWriter must not be
+// shared by concurrent writers; create one per host and stream.
+type LineWriter struct {
+	host   string
+	stream Stream
+	fn     LineFunc
+	buf    []byte
+}
+
+// NewLineWriter returns a [LineWriter] that calls fn with the name of host,
+// stream and each line written to it.
+func NewLineWriter(host Host, stream Stream, fn LineFunc) *LineWriter {
+	return &LineWriter{host: host.Name(), stream: stream, fn: fn}
+}
+
+// Write passes each complete line in p to the LineWriter's [LineFunc] and
+// buffers the remainder until the next Write or Flush.
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(w.host, w.stream, string(bytes.TrimSuffix(w.buf[:i], []byte{'\r'})))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes any buffered partial line to the LineWriter's [LineFunc].
+func (w *LineWriter) Flush() error {
+	if len(w.buf) > 0 {
+		w.fn(w.host, w.stream, string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
+
+// flusher is implemented by writers that buffer output, such as [LineWriter]
+// and [bufio.Writer]. [Shell] flushes its writers when the command completes.
+type flusher interface {
+	Flush() error
+}
+
+// PrefixOutput interleaves the output of many hosts in one [io.Writer], line
+// by line, prefixing each line with the name of the host it came from:
+//
+//	[wrk1] compiling...
+//	[wrk3] compiling...
+//	[wrk1] done
+//
+// Lines from concurrent hosts are written whole, one at a time, so they are
+// never torn. Use [PrefixOutput.Writer] to obtain the writers for a [Shell]:
+//
+//	out := iago.NewPrefixOutput(os.Stdout)
+//	g.Run("build", func(ctx context.Context, host iago.Host) error {
+//		return iago.Shell{
+//			Command: "make",
+//			Stdout:  out.Writer(host, iago.StdoutStream),
+//			Stderr:  out.Writer(host, iago.StderrStream),
+//		}.Apply(ctx, host)
+//	})
+type PrefixOutput struct {
+	// Timestamps prefixes each line with the local time it was completed.
+	Timestamps bool
+	// Color colors the host prefix with ANSI escape codes, using the same
+	// color for every line from a given host.
+	Color bool
+
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time // overridden in tests; nil means time.Now
+}
+
+// NewPrefixOutput returns a [PrefixOutput] that writes to w.
+func NewPrefixOutput(w io.Writer) *PrefixOutput {
+	return &PrefixOutput{w: w}
+}
+
+// Writer returns a new [LineWriter] for the given host and stream that writes
+// its lines to p.
+func (p *PrefixOutput) Writer(host Host, stream Stream) *LineWriter {
+	return NewLineWriter(host, stream, p.WriteLine)
+}
+
+// WriteLine writes a single line of output from host, with its prefix, to the
+// underlying writer. It is a [LineFunc]. Write errors are ignored, since the
+// output is informational and must not fail the command producing it.
+func (p *PrefixOutput) WriteLine(host string, _ Stream, line string) {
+	var b bytes.Buffer
+	if p.Timestamps {
+		now := time.Now
+		if p.now != nil {
+			now = p.now
+		}
+		b.WriteString(now().Format("15:04:05.000 "))
+	}
+	if p.Color {
+		fmt.Fprintf(&b, "\x1b[%dm[%s]\x1b[0m ", hostColor(host), host)
+	} else {
+		fmt.Fprintf(&b, "[%s] ", host)
+	}
+	b.WriteString(line)
+	b.WriteByte('\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _ = p.w.Write(b.Bytes())
+}
+
+// hostColor returns the ANSI foreground color code for host's prefix, chosen
+// from red through cyan by a hash of the name.
+func hostColor(host string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(host))
+	return 31 + int(h.Sum32()%6)
+}
@@ -0,0 +1,106 @@
+package iago
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := NewLineWriter(fakeHost{name: "h"}, StderrStream, func(host string, stream Stream, line string) {
+		lines = append(lines, host+":"+string(stream)+":"+line)
+	})
+	for _, chunk := range []string{"one\ntw", "o\r\n", "", "three\nfour"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"h:stderr:one", "h:stderr:two", "h:stderr:three"}
+	if !slices.Equal(lines, want) {
+		t.Fatalf("lines before Flush = %q, want %q", lines, want)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "h:stderr:four")
+	if !slices.Equal(lines, want) {
+		t.Fatalf("lines after Flush = %q, want %q", lines, want)
+	}
+}
+
+func TestShellFlushesLineWriter(t *testing.T) {
+	host := fakeHost{name: "h", cmd: &fakeCmdRunner{output: "a\nb"}}
+	var lines []string
+	err := Shell{
+		Command: "printf 'a\\nb'",
+		Stdout: NewLineWriter(host, StdoutStream, func(_ string, _ Stream, line string) {
+			lines = append(lines, line)
+		}),
+	}.Apply(context.Background(), host)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if want := []string{"a", "b"}; !slices.Equal(lines, want) {
+		t.Fatalf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestPrefixOutput(t *testing.T) {
+	var sb strings.Builder
+	out := NewPrefixOutput(&sb)
+	out.Timestamps = true
+	out.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 6e6, time.UTC) }
+	w := out.Writer(fakeHost{name: "wrk3"}, StdoutStream)
+	if _, err := w.Write([]byte("compiling...\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sb.String(), "03:04:05.006 [wrk3] compiling...\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	sb.Reset()
+	out = NewPrefixOutput(&sb)
+	out.Color = true
+	out.WriteLine("wrk3", StderrStream, "oops")
+	if got, want := sb.String(), fmt.Sprintf("\x1b[%dm[wrk3]\x1b[0m oops\n", hostColor("wrk3")); got != want {
+		t.Errorf("colored output = %q, want %q", got, want)
+	}
+}
+
+// TestPrefixOutputConcurrent verifies that lines written in fragments by many
+// hosts at once come out whole.
+func TestPrefixOutputConcurrent(t *testing.T) {
+	var sb strings.Builder
+	out := NewPrefixOutput(&sb)
+	const hosts, lines = 8, 100
+	var wg sync.WaitGroup
+	for i := range hosts {
+		wg.Go(func() {
+			name := fmt.Sprintf("h%d", i)
+			w := out.Writer(fakeHost{name: name}, StdoutStream)
+			for j := range lines {
+				for _, part := range []string{"line ", name, fmt.Sprintf(" %d\n", j)} {
+					_, _ = w.Write([]byte(part))
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	got := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	if len(got) != hosts*lines {
+		t.Fatalf("got %d lines, want %d", len(got), hosts*lines)
+	}
+	for _, line := range got {
+		var name, name2 string
+		var n int
+		if _, err := fmt.Sscanf(line, "[%s line %s %d", &name, &name2, &n); err != nil || name != name2+"]" {
+			t.Fatalf("torn line %q", line)
+		}
+	}
+}
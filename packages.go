@@ -0,0 +1,400 @@
+package iago
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	fs "github.com/relab/wrfs"
+)
+
+// PackageManager identifies the package manager of a Linux distribution.
+type PackageManager string
+
+const (
+	// Apt is the package manager of Debian and its derivatives, such as Ubuntu.
+	Apt PackageManager = "apt"
+	// Dnf is the package manager of Fedora and RHEL 8 and later.
+	Dnf PackageManager = "dnf"
+	// Yum is the package manager of RHEL and CentOS 7 and earlier.
+	Yum PackageManager = "yum"
+	// Apk is the package manager of Alpine Linux.
+	Apk PackageManager = "apk"
+	// Pacman is the package manager of Arch Linux.
+	Pacman PackageManager = "pacman"
+	// Zypper is the package manager of openSUSE and SLES.
+	Zypper PackageManager = "zypper"
+)
+
+// ErrUnknownPackageManager is returned when the package manager of a host
+// cannot be determined from its os-release file.
+var ErrUnknownPackageManager = errors.New("unknown package manager")
+
+// packageManager holds the commands used to manage packages with a
+// [PackageManager]. query is a shell command that prints the installed
+// version of the package named by $p, or nothing if it is not installed.
+// available, if set, prints the versions of $p that can be installed, one per
+// line, to which pins are resolved before installing.
+type packageManager struct {
+	query     string
+	available string
+	update    string
+	install   string
+	remove    string
+	// pin returns the argument that installs a given version of a package;
+	// nil means the package manager does not support pinned versions.
+	pin func(name, version string) string
+}
+
+func pinEquals(name, version string) string { return name + "=" + version }
+func pinDash(name, version string) string   { return name + "-" + version }
+
+const rpmQuery = `rpm -q --qf '%{VERSION}-%{RELEASE}' -- "$p"`
+
+var packageManagers = map[PackageManager]packageManager{
+	Apt: {
+		query:     `dpkg-query -W -f='${db:Status-Status} ${Version}' -- "$p" | sed -n 's/^installed //p'`,
+		available: `apt-cache madison "$p" | cut -d '|' -f 2`,
+		update:    "apt-get update",
+		install:   "DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends --",
+		remove:    "DEBIAN_FRONTEND=noninteractive apt-get remove -y --",
+		pin:       pinEquals,
+	},
+	Dnf: {
+		query:   rpmQuery,
+		update:  "dnf makecache",
+		install: "dnf install -y --",
+		remove:  "dnf remove -y --",
+		pin:     pinDash,
+	},
+	Yum: {
+		query:   rpmQuery,
+		update:  "yum makecache",
+		install: "yum install -y --",
+		remove:  "yum remove -y --",
+		pin:     pinDash,
+	},
+	Apk: {
+		query:   `awk -v p="$p" '/^P:/ { n = substr($0, 3) } /^V:/ && n == p { print substr($0, 3) }' /lib/apk/db/installed`,
+		update:  "apk update",
+		install: "apk add --",
+		remove:  "apk del --",
+		pin:     pinEquals,
+	},
+	Pacman: {
+		query:   `pacman -Q -- "$p" | cut -d ' ' -f 2`,
+		update:  "pacman -Sy --noconfirm",
+		install: "pacman -S --noconfirm --needed --",
+		remove:  "pacman -R --noconfirm --",
+	},
+	Zypper: {
+		query:   rpmQuery,
+		update:  "zypper --non-interactive refresh",
+		install: "zypper --non-interactive install --",
+		remove:  "zypper --non-interactive remove --",
+		pin:     pinEquals,
+	},
+}
+
+// DetectPackageManager determines the package manager of host from the ID and
+// ID_LIKE fields of its os-release(5) file.
+func DetectPackageManager(host Host) (PackageManager, error) {
+	release, err := readOSRelease(host)
+	if err != nil {
+		return "", err
+	}
+	ids := append([]string{release["ID"]}, strings.Fields(release["ID_LIKE"])...)
+	for _, id := range ids {
+		switch {
+		case id == "debian" || id == "ubuntu":
+			return Apt, nil
+		case id == "fedora":
+			return Dnf, nil
+		case id == "rhel" || id == "centos" || id == "rocky" || id == "almalinux":
+			if major, _, _ := strings.Cut(release["VERSION_ID"], "."); major != "" {
+				if v, err := strconv.Atoi(major); err == nil && v < 8 {
+					return Yum, nil
+				}
+			}
+			return Dnf, nil
+		case id == "alpine":
+			return Apk, nil
+		case id == "arch" || id == "manjaro":
+			return Pacman, nil
+		case id == "suse" || id == "sles" || strings.HasPrefix(id, "opensuse"):
+			return Zypper, nil
+		}
+	}
+	return "", fmt.Errorf("iago: %s: %w (ID=%q ID_LIKE=%q)", host.Name(), ErrUnknownPackageManager, release["ID"], release["ID_LIKE"])
+}
+
+// readOSRelease reads the os-release file of host.
+func readOSRelease(host Host) (map[string]string, error) {
+	fsys := host.GetFS()
+	data, err := fs.ReadFile(fsys, "etc/os-release")
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = fs.ReadFile(fsys, "usr/lib/os-release")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("iago: failed to read os-release: %w", err)
+	}
+	return parseOSRelease(data), nil
+}
+
+// parseOSRelease parses the shell-compatible KEY=value lines of an
+// os-release(5) file.
+func parseOSRelease(data []byte) map[string]string {
+	release := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(val); err == nil {
+			val = unquoted
+		} else {
+			val = strings.Trim(val, `"'`)
+		}
+		release[key] = val
+	}
+	return release
+}
+
+// packageNameRE matches a package name as accepted by the supported package
+// managers.
+var packageNameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_:@-]*$`)
+
+// Packages installs or removes packages with the package manager of a host:
+//
+//	iago.Packages{Names: []string{"git", "iperf3=3.16-1"}, Become: &iago.Become{}}
+//
+// Packages are specified by name, optionally pinned to a version with
+// "name=version". A pin may omit the release or the epoch of the version, as
+// in "git=2.39.2" for the apt version "1:2.39.2-1"; apt pins are resolved to
+// the newest matching available version before installing. A package is only
+// installed if it is missing or, when pinned, installed at a different
+// version, and only removed if it is installed, so that applying Packages
+// again changes nothing.
+type Packages struct {
+	// Names lists the packages, as "name" or "name=version".
+	Names []string
+	// Remove removes the packages instead of installing them. Versions are
+	// ignored.
+	Remove bool
+	// Update refreshes the package index before installing packages.
+	Update bool
+	// Manager is the package manager to use; empty means the one detected with
+	// [DetectPackageManager].
+	Manager PackageManager
+	// Become, if non-nil, runs the package manager as another user, usually
+	// root.
+	Become *Become
+}
+
+// packageSpec is a package name with an optional pinned version.
+type packageSpec struct {
+	spec, name, version string
+}
+
+// Apply installs or removes the packages on host. It satisfies the task
+// signature of [Group.Run].
+func (p Packages) Apply(ctx context.Context, host Host) error {
+	_, err := p.Ensure(ctx, host)
+	return err
+}
+
+// Ensure installs or removes the packages on host, and returns the entries of
+// p.Names that were changed.
+func (p Packages) Ensure(ctx context.Context, host Host) (changed []string, err error) {
+	specs, err := p.specs()
+	if err != nil || len(specs) == 0 {
+		return nil, err
+	}
+	manager := p.Manager
+	if manager == "" {
+		if manager, err = DetectPackageManager(host); err != nil {
+			return nil, err
+		}
+	}
+	pm, ok := packageManagers[manager]
+	if !ok {
+		return nil, fmt.Errorf("iago: %q: %w", manager, ErrUnknownPackageManager)
+	}
+	installed, err := p.installed(ctx, host, pm, specs)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	var pins []packageSpec // pins to resolve, whose arguments end args
+	for _, s := range specs {
+		version, ok := installed[s.name]
+		switch {
+		case p.Remove && !ok:
+			continue
+		case p.Remove:
+			args = append(args, Quote(s.name))
+		case ok && (s.version == "" || versionMatches(version, s.version)):
+			continue
+		case s.version == "":
+			args = append(args, Quote(s.name))
+		case pm.pin == nil:
+			return nil, fmt.Errorf("iago: %s does not support pinned versions: %s", manager, s.spec)
+		case pm.available != "":
+			pins = append(pins, s)
+		default:
+			args = append(args, Quote(pm.pin(s.name, s.version)))
+		}
+		changed = append(changed, s.spec)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	update := p.Update && !p.Remove
+	if len(pins) > 0 {
+		// The index must be up to date to find the versions to pin.
+		if update {
+			if err := (Shell{Command: pm.update, Become: p.Become}).Apply(ctx, host); err != nil {
+				return nil, fmt.Errorf("iago: failed to update package index: %w", err)
+			}
+			update = false
+		}
+		available, err := p.available(ctx, host, pm, pins)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range pins {
+			args = append(args, Quote(pm.pin(s.name, resolvePin(available[s.name], s.version))))
+		}
+	}
+
+	cmd := pm.install
+	if p.Remove {
+		cmd = pm.remove
+	}
+	cmd += " " + strings.Join(args, " ")
+	if update {
+		cmd = pm.update + " && " + cmd
+	}
+	if err := (Shell{Command: cmd, Become: p.Become}).Apply(ctx, host); err != nil {
+		return nil, fmt.Errorf("iago: failed to %s packages %s: %w", p.verb(), strings.Join(changed, ", "), err)
+	}
+	return changed, nil
+}
+
+func (p Packages) verb() string {
+	if p.Remove {
+		return "remove"
+	}
+	return "install"
+}
+
+// specs parses and validates p.Names.
+func (p Packages) specs() ([]packageSpec, error) {
+	specs := make([]packageSpec, 0, len(p.Names))
+	for _, spec := range p.Names {
+		name, version, _ := strings.Cut(spec, "=")
+		if !packageNameRE.MatchString(name) {
+			return nil, fmt.Errorf("iago: invalid package name %q", spec)
+		}
+		specs = append(specs, packageSpec{spec: spec, name: name, version: version})
+	}
+	return specs, nil
+}
+
+// installed returns the installed versions of the packages in specs, keyed by
+// name. Packages that are not installed are absent.
+func (p Packages) installed(ctx context.Context, host Host, pm packageManager, specs []packageSpec) (map[string]string, error) {
+	names := make([]string, 0, len(specs))
+	for _, s := range specs {
+		if !slices.Contains(names, Quote(s.name)) {
+			names = append(names, Quote(s.name))
+		}
+	}
+	// Each line of output is the name of a package, followed by its installed
+	// version if there is one.
+	script := fmt.Sprintf(`for p in %s; do v=$({ %s; } 2>/dev/null) || v=; echo "$p $v"; done`, strings.Join(names, " "), pm.query)
+	out, err := p.output(ctx, host, script)
+	if err != nil {
+		return nil, fmt.Errorf("iago: failed to query installed packages: %w", err)
+	}
+	installed := make(map[string]string)
+	for line := range strings.Lines(out) {
+		name, version, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if version = strings.TrimSpace(version); name != "" && version != "" {
+			installed[name] = version
+		}
+	}
+	return installed, nil
+}
+
+// available returns the versions of the packages in specs that can be
+// installed, keyed by name, in the order the package manager lists them.
+func (p Packages) available(ctx context.Context, host Host, pm packageManager, specs []packageSpec) (map[string][]string, error) {
+	names := make([]string, 0, len(specs))
+	for _, s := range specs {
+		names = append(names, Quote(s.name))
+	}
+	script := fmt.Sprintf(`for p in %s; do { %s; } 2>/dev/null | while read -r v; do echo "$p $v"; done; done`, strings.Join(names, " "), pm.available)
+	out, err := p.output(ctx, host, script)
+	if err != nil {
+		return nil, fmt.Errorf("iago: failed to query available packages: %w", err)
+	}
+	available := make(map[string][]string)
+	for line := range strings.Lines(out) {
+		name, version, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if version = strings.TrimSpace(version); name != "" && version != "" {
+			available[name] = append(available[name], version)
+		}
+	}
+	return available, nil
+}
+
+// output runs script on host, as p.Become if set, and returns its output.
+func (p Packages) output(ctx context.Context, host Host, script string) (string, error) {
+	if p.Become != nil {
+		return p.Become.Output(ctx, host, script)
+	}
+	return Output(ctx, host, script)
+}
+
+// resolvePin returns the first of the available versions that satisfies the
+// pinned version, as by [versionMatches], or pinned itself if none does, so
+// that the package manager reports the missing version.
+func resolvePin(available []string, pinned string) string {
+	for _, v := range available {
+		if versionMatches(v, pinned) {
+			return v
+		}
+	}
+	return pinned
+}
+
+// versionMatches reports whether the installed version satisfies the pinned
+// version. A pin without a release, such as "1.2" for RPM or apk packages,
+// matches any release of that version. A pin without an epoch, such as
+// "2.3-4" for an apt package installed as "1:2.3-4", matches any epoch.
+func versionMatches(installed, pinned string) bool {
+	if epoch, version, ok := strings.Cut(installed, ":"); ok && !strings.Contains(pinned, ":") && isEpoch(epoch) {
+		installed = version
+	}
+	return installed == pinned || strings.HasPrefix(installed, pinned+"-")
+}
+
+// isEpoch reports whether s is the epoch of a Debian or RPM version.
+func isEpoch(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 32)
+	return err == nil
+}
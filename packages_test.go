@@ -0,0 +1,191 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/relab/wrfs"
+)
+
+// osReleaseHost returns a fakeHost whose file system holds an os-release file
+// with the given contents.
+func osReleaseHost(t *testing.T, osRelease string, cmd CmdRunner) fakeHost {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "os-release"), []byte(osRelease), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fakeHost{name: "wrk1", cmd: cmd, fsys: wrfs.DirFS(root)}
+}
+
+func TestDetectPackageManager(t *testing.T) {
+	tests := []struct {
+		osRelease string
+		want      PackageManager
+	}{
+		{osRelease: "ID=debian\nVERSION_ID=\"12\"\n", want: Apt},
+		{osRelease: "NAME=\"Ubuntu\"\nID=ubuntu\nID_LIKE=debian\n", want: Apt},
+		{osRelease: "ID=linuxmint\nID_LIKE=\"ubuntu debian\"\n", want: Apt},
+		{osRelease: "ID=fedora\nVERSION_ID=40\n", want: Dnf},
+		{osRelease: "ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"9.3\"\n", want: Dnf},
+		{osRelease: "ID=\"centos\"\nID_LIKE=\"rhel fedora\"\nVERSION_ID=\"7\"\n", want: Yum},
+		{osRelease: "ID=alpine\nVERSION_ID=3.20.0\n", want: Apk},
+		{osRelease: "ID=arch\n", want: Pacman},
+		{osRelease: "ID=\"opensuse-leap\"\nID_LIKE=\"suse opensuse\"\n", want: Zypper},
+		{osRelease: "# comment\nID=gentoo\n"},
+	}
+	for _, tt := range tests {
+		got, err := DetectPackageManager(osReleaseHost(t, tt.osRelease, nil))
+		if tt.want == "" {
+			if !errors.Is(err, ErrUnknownPackageManager) {
+				t.Errorf("DetectPackageManager(%q) error = %v, want %v", tt.osRelease, err, ErrUnknownPackageManager)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("DetectPackageManager(%q) = %q, %v, want %q", tt.osRelease, got, err, tt.want)
+		}
+	}
+}
+
+// scriptedCmdRunner is a fakeCmdRunner whose StdoutPipe returns the next of
+// outputs on each call, or nothing once they run out, so that a test can
+// answer a sequence of commands.
+type scriptedCmdRunner struct {
+	fakeCmdRunner
+	outputs []string
+}
+
+func (r *scriptedCmdRunner) StdoutPipe() (io.ReadCloser, error) {
+	var out string
+	if len(r.outputs) > 0 {
+		out, r.outputs = r.outputs[0], r.outputs[1:]
+	}
+	return io.NopCloser(strings.NewReader(out)), nil
+}
+
+func TestPackagesEnsure(t *testing.T) {
+	tests := []struct {
+		name        string
+		pkgs        Packages
+		outputs     []string // outputs of the commands Ensure runs, in order
+		wantChanged []string
+		wantCmd     string
+	}{
+		{
+			name:        "InstallMissing",
+			pkgs:        Packages{Names: []string{"git", "iperf3"}},
+			outputs:     []string{"git 1:2.39.2-1\niperf3 \n"},
+			wantChanged: []string{"iperf3"},
+			wantCmd:     "DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends -- 'iperf3'",
+		},
+		{
+			name:    "AllInstalled",
+			pkgs:    Packages{Names: []string{"git", "iperf3"}},
+			outputs: []string{"git 1:2.39.2-1\niperf3 3.12-1\n"},
+		},
+		{
+			name:        "PinMismatch",
+			pkgs:        Packages{Names: []string{"iperf3=3.16-1"}, Update: true},
+			outputs:     []string{"iperf3 3.12-1\n"},
+			wantChanged: []string{"iperf3=3.16-1"},
+			wantCmd:     "DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends -- 'iperf3=3.16-1'",
+		},
+		{
+			name:        "PartialPin",
+			pkgs:        Packages{Names: []string{"git=2.39.2"}},
+			outputs:     []string{"git \n", "git 1:2.39.5-0+deb12u1\ngit 1:2.39.2-1.1\n"},
+			wantChanged: []string{"git=2.39.2"},
+			wantCmd:     "DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends -- 'git=1:2.39.2-1.1'",
+		},
+		{
+			name:    "PinMatches",
+			pkgs:    Packages{Names: []string{"iperf3=3.12-1"}},
+			outputs: []string{"iperf3 3.12-1\n"},
+		},
+		{
+			name:    "PinWithoutEpoch",
+			pkgs:    Packages{Names: []string{"git=2.39.2-1"}},
+			outputs: []string{"git 1:2.39.2-1\n"},
+		},
+		{
+			name:        "Remove",
+			pkgs:        Packages{Names: []string{"git", "iperf3"}, Remove: true},
+			outputs:     []string{"git 1:2.39.2-1\niperf3 \n"},
+			wantChanged: []string{"git"},
+			wantCmd:     "DEBIAN_FRONTEND=noninteractive apt-get remove -y -- 'git'",
+		},
+		{
+			name:        "ExplicitManager",
+			pkgs:        Packages{Names: []string{"tree=2.1"}, Manager: Dnf},
+			outputs:     []string{"tree \n"},
+			wantChanged: []string{"tree=2.1"},
+			wantCmd:     "dnf install -y -- 'tree-2.1'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &scriptedCmdRunner{outputs: tt.outputs}
+			host := osReleaseHost(t, "ID=debian\n", runner)
+			changed, err := tt.pkgs.Ensure(context.Background(), host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(changed, tt.wantChanged) {
+				t.Errorf("Ensure() changed = %q, want %q", changed, tt.wantChanged)
+			}
+			if tt.wantCmd == "" {
+				if !strings.HasPrefix(runner.cmd, "for p in") {
+					t.Errorf("Ensure() ran %q after querying, want nothing", runner.cmd)
+				}
+			} else if runner.cmd != tt.wantCmd {
+				t.Errorf("Ensure() ran %q, want %q", runner.cmd, tt.wantCmd)
+			}
+		})
+	}
+}
+
+func TestPackagesInvalid(t *testing.T) {
+	for _, pkgs := range []Packages{
+		{Names: []string{"git; rm -rf /"}, Manager: Apt},
+		{Names: []string{"-y"}, Manager: Apt},
+		{Names: []string{"git"}, Manager: "brew"},
+		{Names: []string{"git=2.45"}, Manager: Pacman},
+	} {
+		host := fakeHost{name: "wrk1", cmd: &fakeCmdRunner{output: "git \n"}}
+		if _, err := pkgs.Ensure(context.Background(), host); err == nil {
+			t.Errorf("Ensure(%+v) succeeded, want error", pkgs)
+		}
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	tests := []struct {
+		installed, pinned string
+		want              bool
+	}{
+		{"3.12-1", "3.12-1", true},
+		{"3.12-1", "3.12", true},
+		{"3.12-1", "3.1", false},
+		{"3.120-1", "3.12", false},
+		{"2.1-r0", "2.1", true},
+		{"1:2.39.2-1", "2.39.2-1", true},
+		{"1:2.39.2-1", "2.39.2", true},
+		{"1:2.39.2-1", "1:2.39.2-1", true},
+		{"1:2.39.2-1", "2:2.39.2-1", false},
+	}
+	for _, tt := range tests {
+		if got := versionMatches(tt.installed, tt.pinned); got != tt.want {
+			t.Errorf("versionMatches(%q, %q) = %t, want %t", tt.installed, tt.pinned, got, tt.want)
+		}
+	}
+}
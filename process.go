@@ -0,0 +1,275 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processNameRE matches a valid [Process] name, which is used in file names.
+var processNameRE = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Process is a long-running command, such as a server, that is started
+// detached from the SSH session on a remote host, so that it outlives the task
+// that started it and the connection itself. It can then be monitored and
+// stopped from later tasks:
+//
+//	replica := iago.Process{Name: "replica", Command: "./replica --id 1"}
+//	g.Run("start replicas", replica.Apply)
+//	// ... run the experiment ...
+//	g.Run("stop replicas", replica.Stop)
+//
+// The command runs in a new session (with setsid, or nohup where setsid is
+// unavailable) with its standard output and error redirected to a log file.
+// Its process ID is written to a PID file and stored in a host variable, and
+// its exit status is written to a file when it exits. All state files are
+// kept in StateDir, named after Name.
+type Process struct {
+	// Name identifies the process on the host. It may only contain letters,
+	// digits, '.', '_' and '-'.
+	Name string
+	// Command is the shell command to run.
+	Command string
+	// StateDir is the remote directory holding the PID, log and exit status
+	// files; empty means $HOME/.iago.
+	StateDir string
+	// LogFile is the remote file receiving the output of the command; empty
+	// means <StateDir>/<Name>.log.
+	LogFile string
+	// Grace is the time [Process.Stop] waits for the process to exit after
+	// SIGTERM before sending SIGKILL; zero means [DefaultGrace].
+	Grace time.Duration
+	// Become, if non-nil, runs and manages the process as another user.
+	Become *Become
+}
+
+// ProcessStatus describes the state of a [Process] on a host.
+type ProcessStatus struct {
+	// PID is the process ID of the process.
+	PID int
+	// Running reports whether the process is still running.
+	Running bool
+	// ExitCode is the exit status of the process, or -1 if it is still running
+	// or exited without recording one, for example because it was killed.
+	ExitCode int
+}
+
+// ProcessExitError is returned by [Process.Wait] when the process exits
+// non-zero. It implements [ExitStatus].
+type ProcessExitError struct {
+	Name string
+	Code int
+}
+
+func (e ProcessExitError) Error() string {
+	return fmt.Sprintf("process %s exited with status %d", e.Name, e.Code)
+}
+
+// ExitStatus returns the exit status of the process.
+func (e ProcessExitError) ExitStatus() int {
+	return e.Code
+}
+
+// ErrProcessNotStarted is returned when a [Process] is managed on a host where
+// it was never started.
+var ErrProcessNotStarted = errors.New("process not started")
+
+// pidVar returns the name of the host variable holding the process ID.
+func (p Process) pidVar() string {
+	return "iago.process." + p.Name + ".pid"
+}
+
+func (p Process) validate() error {
+	if !processNameRE.MatchString(p.Name) {
+		return fmt.Errorf("iago: invalid process name %q", p.Name)
+	}
+	return nil
+}
+
+// files returns the remote paths of the state files of p on host.
+func (p Process) files(host Host) (dir, pidFile, logFile, exitFile string) {
+	dir = p.StateDir
+	if dir == "" {
+		dir = path.Join(Expand(host, "$HOME"), ".iago")
+		if !path.IsAbs(dir) {
+			dir = "/tmp/.iago"
+		}
+	}
+	logFile = p.LogFile
+	if logFile == "" {
+		logFile = path.Join(dir, p.Name+".log")
+	}
+	return dir, path.Join(dir, p.Name+".pid"), logFile, path.Join(dir, p.Name+".exit")
+}
+
+// output runs script on host as p's user.
+func (p Process) output(ctx context.Context, host Host, script string) (string, error) {
+	if p.Become != nil {
+		return p.Become.Output(ctx, host, script)
+	}
+	return Output(ctx, host, script)
+}
+
+// Apply starts the process on host. It satisfies the task signature of
+// [Group.Run].
+func (p Process) Apply(ctx context.Context, host Host) error {
+	_, err := p.Start(ctx, host)
+	return err
+}
+
+// Start starts the process on host and returns its process ID. It returns
+// once the process has been launched, without waiting for it to exit.
+func (p Process) Start(ctx context.Context, host Host) (int, error) {
+	if err := p.validate(); err != nil {
+		return 0, err
+	}
+	dir, pidFile, logFile, exitFile := p.files(host)
+	// The command runs in a subshell so that the exit status is recorded even
+	// if it calls exit.
+	run := "(\n" + p.Command + "\n)\necho $? > " + Quote(exitFile)
+	script := strings.Join([]string{
+		fmt.Sprintf("mkdir -p %s %s", Quote(dir), Quote(path.Dir(logFile))),
+		"rm -f " + Quote(exitFile),
+		"if command -v setsid >/dev/null 2>&1; then launch=setsid; else launch=nohup; fi",
+		fmt.Sprintf("$launch sh -c %s > %s 2>&1 < /dev/null &", Quote(run), Quote(logFile)),
+		"echo $! > " + Quote(pidFile),
+		"echo $!",
+	}, "\n")
+	out, err := p.output(ctx, host, script)
+	if err != nil {
+		return 0, fmt.Errorf("iago: failed to start process %s: %w", p.Name, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("iago: failed to start process %s: unexpected output %q", p.Name, out)
+	}
+	host.SetVar(p.pidVar(), pid)
+	return pid, nil
+}
+
+// pid returns the process ID of p on host, from the host variable set by
+// [Process.Start] or else from the PID file.
+func (p Process) pid(ctx context.Context, host Host) (int, error) {
+	if err := p.validate(); err != nil {
+		return 0, err
+	}
+	if pid := GetIntVar(host, p.pidVar()); pid > 0 {
+		return pid, nil
+	}
+	_, pidFile, _, _ := p.files(host)
+	out, err := p.output(ctx, host, "cat "+Quote(pidFile)+" 2>/dev/null || true")
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("iago: %s: %w", p.Name, ErrProcessNotStarted)
+	}
+	host.SetVar(p.pidVar(), pid)
+	return pid, nil
+}
+
+// Status returns the state of the process on host.
+func (p Process) Status(ctx context.Context, host Host) (ProcessStatus, error) {
+	pid, err := p.pid(ctx, host)
+	if err != nil {
+		return ProcessStatus{}, err
+	}
+	_, _, _, exitFile := p.files(host)
+	script := fmt.Sprintf("if kill -0 %d 2>/dev/null; then echo running; else cat %s 2>/dev/null || echo -1; fi", pid, Quote(exitFile))
+	out, err := p.output(ctx, host, script)
+	if err != nil {
+		return ProcessStatus{}, err
+	}
+	return parseProcessStatus(pid, out)
+}
+
+// parseProcessStatus parses the output of the status script of [Process.Status].
+func parseProcessStatus(pid int, out string) (ProcessStatus, error) {
+	out = strings.TrimSpace(out)
+	if out == "running" {
+		return ProcessStatus{PID: pid, Running: true, ExitCode: -1}, nil
+	}
+	code, err := strconv.Atoi(out)
+	if err != nil {
+		return ProcessStatus{}, fmt.Errorf("iago: unexpected process status %q", out)
+	}
+	return ProcessStatus{PID: pid, ExitCode: code}, nil
+}
+
+// processPollInterval is how often [Process.Wait] checks whether the process
+// has exited.
+const processPollInterval = time.Second
+
+// Wait waits for the process to exit on host, or for ctx to be done. It
+// returns a [ProcessExitError] if the process exited non-zero, and an error if
+// it exited without recording its exit status.
+func (p Process) Wait(ctx context.Context, host Host) error {
+	ticker := time.NewTicker(processPollInterval)
+	defer ticker.Stop()
+	for {
+		status, err := p.Status(ctx, host)
+		if err != nil {
+			return err
+		}
+		if !status.Running {
+			switch status.ExitCode {
+			case 0:
+				return nil
+			case -1:
+				return fmt.Errorf("iago: process %s exited without recording its exit status", p.Name)
+			}
+			return ProcessExitError{Name: p.Name, Code: status.ExitCode}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop terminates the process on host and its process group: it sends
+// SIGTERM, waits up to p.Grace for the process to exit, and then sends
+// SIGKILL. Stopping a process that is not running is not an error.
+func (p Process) Stop(ctx context.Context, host Host) error {
+	pid, err := p.pid(ctx, host)
+	if err != nil {
+		return err
+	}
+	grace := p.Grace
+	if grace <= 0 {
+		grace = DefaultGrace
+	}
+	script := strings.Join([]string{
+		fmt.Sprintf("kill -s TERM -- -%[1]d 2>/dev/null || kill -s TERM %[1]d 2>/dev/null || exit 0", pid),
+		"i=0",
+		fmt.Sprintf("while kill -0 %d 2>/dev/null; do", pid),
+		fmt.Sprintf("  if [ $i -ge %d ]; then kill -s KILL -- -%[2]d 2>/dev/null || kill -s KILL %[2]d; break; fi", int(math.Ceil(grace.Seconds())), pid),
+		"  sleep 1; i=$((i+1))",
+		"done",
+	}, "\n")
+	if _, err := p.output(ctx, host, script); err != nil {
+		return fmt.Errorf("iago: failed to stop process %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// Logs returns the last n lines of the output of the process on host, or all
+// of it if n is zero or less.
+func (p Process) Logs(ctx context.Context, host Host, n int) (string, error) {
+	if err := p.validate(); err != nil {
+		return "", err
+	}
+	_, _, logFile, _ := p.files(host)
+	if n > 0 {
+		return p.output(ctx, host, fmt.Sprintf("tail -n %d %s", n, Quote(logFile)))
+	}
+	return p.output(ctx, host, "cat "+Quote(logFile))
+}
@@ -0,0 +1,123 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProcessStart(t *testing.T) {
+	runner := &fakeCmdRunner{output: "4242\n"}
+	host := fakeHost{name: "wrk1", cmd: runner, vars: map[string]any{}}
+	p := Process{Name: "replica", Command: "./replica --id 1", StateDir: "/var/run/bench"}
+
+	pid, err := p.Start(context.Background(), host)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if pid != 4242 {
+		t.Errorf("Start() pid = %d, want 4242", pid)
+	}
+	if got := GetIntVar(host, "iago.process.replica.pid"); got != 4242 {
+		t.Errorf("pid variable = %d, want 4242", got)
+	}
+	for _, want := range []string{
+		"mkdir -p '/var/run/bench'",
+		"rm -f '/var/run/bench/replica.exit'",
+		"> '/var/run/bench/replica.log' 2>&1 < /dev/null &",
+		"echo $! > '/var/run/bench/replica.pid'",
+		"./replica --id 1",
+	} {
+		if !strings.Contains(runner.cmd, want) {
+			t.Errorf("Start() command missing %q:\n%s", want, runner.cmd)
+		}
+	}
+}
+
+func TestProcessInvalidName(t *testing.T) {
+	for _, name := range []string{"", "a/b", "a b", "$(x)"} {
+		host := fakeHost{name: "wrk1", cmd: &fakeCmdRunner{}}
+		if _, err := (Process{Name: name, Command: "true"}).Start(context.Background(), host); err == nil {
+			t.Errorf("Start() with name %q succeeded, want error", name)
+		}
+	}
+}
+
+func TestProcessFiles(t *testing.T) {
+	host := fakeHost{name: "wrk1"}
+	dir, pidFile, logFile, exitFile := Process{Name: "srv"}.files(host)
+	if dir != "/tmp/.iago" || pidFile != "/tmp/.iago/srv.pid" || logFile != "/tmp/.iago/srv.log" || exitFile != "/tmp/.iago/srv.exit" {
+		t.Errorf("files() = %q, %q, %q, %q", dir, pidFile, logFile, exitFile)
+	}
+	_, _, logFile, _ = Process{Name: "srv", StateDir: "/run", LogFile: "/var/log/srv.log"}.files(host)
+	if logFile != "/var/log/srv.log" {
+		t.Errorf("files() log = %q, want /var/log/srv.log", logFile)
+	}
+}
+
+func TestProcessStatus(t *testing.T) {
+	tests := []struct {
+		output string
+		want   ProcessStatus
+	}{
+		{output: "running\n", want: ProcessStatus{PID: 7, Running: true, ExitCode: -1}},
+		{output: "0\n", want: ProcessStatus{PID: 7, ExitCode: 0}},
+		{output: "3\n", want: ProcessStatus{PID: 7, ExitCode: 3}},
+		{output: "-1\n", want: ProcessStatus{PID: 7, ExitCode: -1}},
+	}
+	for _, tt := range tests {
+		host := fakeHost{name: "wrk1", cmd: &fakeCmdRunner{output: tt.output}, vars: map[string]any{"iago.process.srv.pid": 7}}
+		got, err := Process{Name: "srv"}.Status(context.Background(), host)
+		if err != nil {
+			t.Fatalf("Status() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("Status() with output %q = %+v, want %+v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestProcessWait(t *testing.T) {
+	tests := []struct {
+		output   string
+		wantCode int
+		wantErr  bool
+	}{
+		{output: "0", wantCode: 0},
+		{output: "3", wantCode: 3, wantErr: true},
+		{output: "-1", wantCode: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		host := fakeHost{name: "wrk1", cmd: &fakeCmdRunner{output: tt.output}, vars: map[string]any{"iago.process.srv.pid": 7}}
+		err := Process{Name: "srv"}.Wait(context.Background(), host)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Wait() with output %q error = %v, wantErr %v", tt.output, err, tt.wantErr)
+		}
+		var exitErr ExitStatus
+		if tt.wantCode > 0 && (!errors.As(err, &exitErr) || exitErr.ExitStatus() != tt.wantCode) {
+			t.Errorf("Wait() error = %v, want exit status %d", err, tt.wantCode)
+		}
+	}
+}
+
+func TestProcessNotStarted(t *testing.T) {
+	host := fakeHost{name: "wrk1", cmd: &fakeCmdRunner{}, vars: map[string]any{}}
+	err := Process{Name: "srv"}.Stop(context.Background(), host)
+	if !errors.Is(err, ErrProcessNotStarted) {
+		t.Errorf("Stop() error = %v, want %v", err, ErrProcessNotStarted)
+	}
+}
+
+func TestProcessStop(t *testing.T) {
+	runner := &fakeCmdRunner{}
+	host := fakeHost{name: "wrk1", cmd: runner, vars: map[string]any{"iago.process.srv.pid": 7}}
+	if err := (Process{Name: "srv"}).Stop(context.Background(), host); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	for _, want := range []string{"kill -s TERM -- -7", "if [ $i -ge 5 ]; then kill -s KILL -- -7"} {
+		if !strings.Contains(runner.cmd, want) {
+			t.Errorf("Stop() command missing %q:\n%s", want, runner.cmd)
+		}
+	}
+}
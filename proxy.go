@@ -0,0 +1,315 @@
+package iago
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// iagoProxyKeyword is the ssh_config(5) keyword that routes the connection to
+// a host through a SOCKS5 or HTTP CONNECT proxy, as in
+// "IagoProxy socks5://proxy.example.com:1080". As with IagoVar, files shared
+// with ssh(1) must also contain "IgnoreUnknown IagoProxy".
+const iagoProxyKeyword = "IagoProxy"
+
+// Proxy returns a [GroupOption] that routes the connections of [NewSSHGroup]
+// through the proxy at proxyURL; [DialSSHProxy] takes the same URL. The URL has the form
+// scheme://[user:password@]host[:port], where scheme is one of:
+//
+//   - socks5: a SOCKS5 proxy, with host names resolved locally;
+//   - socks5h: a SOCKS5 proxy, with host names resolved by the proxy;
+//   - http: an HTTP proxy supporting the CONNECT method.
+//
+// The port defaults to 1080 for SOCKS5 and 80 for HTTP. The user and
+// password, if given, authenticate with the proxy. Only connections made
+// directly from this program use the proxy: hops tunnelled through a ProxyJump
+// host do not, and hosts with a ProxyCommand use the command instead. A host
+// can override the option with IagoProxy in the SSH config, where "none"
+// dials the host without a proxy.
+func Proxy(proxyURL string) GroupOption {
+	return func(cfg *groupConfig) {
+		cfg.proxy = proxyURL
+	}
+}
+
+// proxyURL returns the proxy through which alias is dialed, or nil if it is
+// dialed without a proxy.
+func (cw *sshConfig) proxyURL(alias string) (*url.URL, error) {
+	value, err := cw.get(alias, iagoProxyKeyword)
+	if err != nil {
+		return nil, err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		value = cw.proxy
+	}
+	if value == "" || strings.EqualFold(value, "none") {
+		return nil, nil
+	}
+	return parseProxyURL(value)
+}
+
+// parseProxyURL parses and validates a proxy URL as described by [Proxy],
+// adding the default port if it is missing.
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("iago: invalid proxy URL: %w", err)
+	}
+	var port string
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		port = "1080"
+	case "http":
+		port = "80"
+	default:
+		return nil, fmt.Errorf("iago: invalid proxy URL %q: unsupported scheme %q", u.Redacted(), u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("iago: invalid proxy URL %q: missing host", u.Redacted())
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("iago: invalid proxy URL %q: unexpected path", u.Redacted())
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// dialSSHProxy establishes an SSH connection to addr through proxy. As with
+// [ssh.Dial], cfg.Timeout bounds the connection to the target, here including
+// the exchange with the proxy, but not the SSH handshake.
+func dialSSHProxy(proxy *url.URL, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := dialProxy(proxy, addr, cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// dialProxy returns a connection to addr through proxy, failing if it takes
+// longer than timeout, unless timeout is zero.
+func dialProxy(proxy *url.URL, addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", proxy.Host, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("iago: dial proxy %s: %w", proxy.Redacted(), err)
+	}
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+	switch proxy.Scheme {
+	case "http":
+		conn, err = httpConnect(conn, proxy, addr)
+	default:
+		err = socks5Connect(conn, proxy, addr)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("iago: proxy %s: %s: %w", proxy.Redacted(), addr, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// SOCKS5 protocol constants from RFC 1928 and RFC 1929.
+const (
+	socks5Version      = 0x05
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5AuthNoAccept = 0xff
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+	socks5PasswordAuth = 0x01
+)
+
+var socks5Replies = []string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect asks the SOCKS5 proxy on conn to connect to addr.
+func socks5Connect(conn net.Conn, proxy *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+	if proxy.Scheme == "socks5" && net.ParseIP(host) == nil {
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return err
+		}
+		host = ips[0].String()
+	}
+
+	method := byte(socks5AuthNone)
+	if proxy.User != nil {
+		method = socks5AuthPassword
+	}
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+	switch reply[1] {
+	case method:
+	case socks5AuthNoAccept:
+		return errors.New("no acceptable SOCKS authentication method")
+	default:
+		return fmt.Errorf("unexpected SOCKS authentication method %d", reply[1])
+	}
+	if method == socks5AuthPassword {
+		if err := socks5Authenticate(conn, proxy.User); err != nil {
+			return err
+		}
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(append(req, socks5AddrIPv4), ip4...)
+		} else {
+			req = append(append(req, socks5AddrIPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("host name %q too long", host)
+		}
+		req = append(append(req, socks5AddrDomain, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return err
+	}
+	if code := head[1]; code != 0 {
+		if int(code) < len(socks5Replies) {
+			return errors.New(socks5Replies[code])
+		}
+		return fmt.Errorf("unknown SOCKS reply %d", code)
+	}
+	// Skip the bound address and port.
+	var n int
+	switch head[3] {
+	case socks5AddrIPv4:
+		n = net.IPv4len
+	case socks5AddrIPv6:
+		n = net.IPv6len
+	case socks5AddrDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return err
+		}
+		n = int(l[0])
+	default:
+		return fmt.Errorf("unknown SOCKS address type %d", head[3])
+	}
+	_, err = io.CopyN(io.Discard, conn, int64(n)+2)
+	return err
+}
+
+// socks5Authenticate authenticates with user's name and password, as
+// described by RFC 1929.
+func socks5Authenticate(conn net.Conn, user *url.Userinfo) error {
+	name := user.Username()
+	password, _ := user.Password()
+	if len(name) > 255 || len(password) > 255 {
+		return errors.New("SOCKS user name or password too long")
+	}
+	req := []byte{socks5PasswordAuth, byte(len(name))}
+	req = append(req, name...)
+	req = append(req, byte(len(password)))
+	req = append(req, password...)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return errors.New("SOCKS authentication failed")
+	}
+	return nil
+}
+
+// httpConnect asks the HTTP proxy on conn to connect to addr with the
+// CONNECT method. The returned connection includes any data the proxy sent
+// after its response, such as the banner of the SSH server.
+func httpConnect(conn net.Conn, proxy *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return conn, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return conn, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return conn, fmt.Errorf("CONNECT failed: %s", resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a [net.Conn] whose reads are served by r, which holds data
+// already read from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
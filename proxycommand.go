@@ -0,0 +1,187 @@
+package iago
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// proxyCommand returns the ProxyCommand of alias with its %h, %p, %r and %%
+// tokens expanded for a connection as user, or an empty string if alias has
+// no ProxyCommand.
+func (cw *sshConfig) proxyCommand(alias, user string) (string, error) {
+	command, err := cw.rawProxyCommand(alias)
+	if err != nil || command == "" {
+		return "", err
+	}
+	host, port, err := net.SplitHostPort(cw.ConnectAddr(alias))
+	if err != nil {
+		return "", fmt.Errorf("iago: invalid address for %s: %w", alias, err)
+	}
+	command, err = expandProxyCommand(command, host, port, user)
+	if err != nil {
+		return "", fmt.Errorf("iago: invalid ProxyCommand for %s: %w", alias, err)
+	}
+	return command, nil
+}
+
+// rawProxyCommand returns the unexpanded ProxyCommand of alias, or an empty
+// string if it has none or it is "none".
+func (cw *sshConfig) rawProxyCommand(alias string) (string, error) {
+	command, err := cw.get(alias, "ProxyCommand")
+	if err != nil {
+		return "", err
+	}
+	command = strings.TrimSpace(command)
+	if strings.EqualFold(command, "none") {
+		return "", nil
+	}
+	return command, nil
+}
+
+// expandProxyCommand replaces the %h, %p and %r tokens of command with host,
+// port and user, and %% with a single %.
+func expandProxyCommand(command, host, port, user string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(command); i++ {
+		if command[i] != '%' {
+			b.WriteByte(command[i])
+			continue
+		}
+		i++
+		if i == len(command) {
+			return "", fmt.Errorf("trailing %% in %q", command)
+		}
+		switch command[i] {
+		case 'h':
+			b.WriteString(host)
+		case 'p':
+			b.WriteString(port)
+		case 'r':
+			b.WriteString(user)
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("unknown token %%%c in %q", command[i], command)
+		}
+	}
+	return b.String(), nil
+}
+
+// dialProxyCommand establishes an SSH connection to addr over the standard
+// input and output of command, run locally by /bin/sh. The command's standard
+// error is passed through to that of the program, as OpenSSH does. The
+// command is stopped when the connection is closed. The SSH handshake must
+// complete within cfg.Timeout, if set, so that a command that hangs does not
+// block the dial forever.
+func dialProxyCommand(command, addr string, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := newProxyCommandConn(command, addr)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(cfg.Timeout))
+	}
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy command %q: %w", command, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// proxyCommandConn is a [net.Conn] that reads from the standard output of a
+// local command and writes to its standard input.
+type proxyCommandConn struct {
+	cmd       *exec.Cmd
+	stdin     *os.File // write end of the command's standard input
+	stdout    *os.File // read end of the command's standard output
+	addr      proxyCommandAddr
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// newProxyCommandConn starts command and returns a connection to it, whose
+// remote address is addr.
+func newProxyCommandConn(command, addr string) (*proxyCommandConn, error) {
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		_ = inR.Close()
+		_ = inW.Close()
+		return nil, err
+	}
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdin = inR
+	cmd.Stdout = outW
+	cmd.Stderr = os.Stderr
+	err = cmd.Start()
+	// The child holds its own copies of these ends.
+	_ = inR.Close()
+	_ = outW.Close()
+	if err != nil {
+		_ = inW.Close()
+		_ = outR.Close()
+		return nil, fmt.Errorf("proxy command %q: %w", command, err)
+	}
+	return &proxyCommandConn{cmd: cmd, stdin: inW, stdout: outR, addr: proxyCommandAddr(addr)}, nil
+}
+
+func (c *proxyCommandConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *proxyCommandConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close closes the command's standard input and output and stops the
+// command.
+func (c *proxyCommandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = errors.Join(c.stdin.Close(), c.stdout.Close())
+		// The command may exit on its own once its input is closed, but one
+		// blocked on the network would linger, so it is killed either way.
+		_ = c.cmd.Process.Kill()
+		_ = c.cmd.Wait()
+	})
+	return c.closeErr
+}
+
+func (c *proxyCommandConn) LocalAddr() net.Addr {
+	return proxyCommandAddr("")
+}
+
+func (c *proxyCommandConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *proxyCommandConn) SetDeadline(t time.Time) error {
+	return errors.Join(c.stdin.SetWriteDeadline(t), c.stdout.SetReadDeadline(t))
+}
+
+func (c *proxyCommandConn) SetReadDeadline(t time.Time) error {
+	return c.stdout.SetReadDeadline(t)
+}
+
+func (c *proxyCommandConn) SetWriteDeadline(t time.Time) error {
+	return c.stdin.SetWriteDeadline(t)
+}
+
+// proxyCommandAddr is the address of the host reached by a ProxyCommand.
+type proxyCommandAddr string
+
+func (a proxyCommandAddr) Network() string { return "proxycommand" }
+
+func (a proxyCommandAddr) String() string { return string(a) }
@@ -0,0 +1,133 @@
+package iago
+
+import (
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestExpandProxyCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string
+		wantErr bool
+	}{
+		{name: "NoTokens", command: "nc bastion 22", want: "nc bastion 22"},
+		{name: "AllTokens", command: "ssh -W %h:%p -l %r gw", want: "ssh -W wrk1.example.com:2222 -l deploy gw"},
+		{name: "Percent", command: "echo 100%%", want: "echo 100%"},
+		{name: "UnknownToken", command: "nc %x", wantErr: true},
+		{name: "TrailingPercent", command: "nc %", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandProxyCommand(tt.command, "wrk1.example.com", "2222", "deploy")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandProxyCommand(%q) error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expandProxyCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyCommandConfig(t *testing.T) {
+	config, err := ParseSSHConfig("testdata/config-proxycommand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		alias     string
+		want      string
+		wantChain []string
+		wantErr   bool
+	}{
+		{name: "Expanded", alias: "iap", want: "tunnel-helper --host=10.0.0.5 --port=2200 --user=deploy --label=100%"},
+		{name: "FirstHop", alias: "behind-iap", wantChain: []string{"iap", "inner"}},
+		{name: "None", alias: "disabled", wantChain: []string{"bastion"}},
+		{name: "NotSet", alias: "other"},
+		{name: "BadToken", alias: "bad-token", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.proxyCommand(tt.alias, "deploy")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("proxyCommand(%s) error = %v, wantErr %v", tt.alias, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("proxyCommand(%s) = %q, want %q", tt.alias, got, tt.want)
+			}
+			chain, err := config.jumpChain(tt.alias)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(chain, tt.wantChain) {
+				t.Errorf("jumpChain(%s) = %q, want %q", tt.alias, chain, tt.wantChain)
+			}
+		})
+	}
+}
+
+func TestProxyCommandConn(t *testing.T) {
+	conn, err := newProxyCommandConn("cat", "wrk1:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.RemoteAddr().String(); got != "wrk1:22" {
+		t.Errorf("RemoteAddr() = %q, want wrk1:22", got)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("read %q through cat, want ping", buf)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if conn.cmd.ProcessState == nil {
+		t.Error("command still running after Close")
+	}
+	if err := conn.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestDialProxyCommandFails(t *testing.T) {
+	config, err := ParseSSHConfig("testdata/config-proxycommand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.dial("quits", &ssh.ClientConfig{User: "deploy", HostKeyCallback: ssh.InsecureIgnoreHostKey()}, nil); err == nil {
+		t.Error("dial through a proxy command that exits succeeded")
+	}
+}
+
+func TestDialProxyCommandTimeout(t *testing.T) {
+	cfg := &ssh.ClientConfig{User: "deploy", HostKeyCallback: ssh.InsecureIgnoreHostKey(), Timeout: 100 * time.Millisecond}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := dialProxyCommand("exec sleep 10", "tpu-1:22", cfg)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("dial through a proxy command that hangs succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("dial through a proxy command that hangs did not time out")
+	}
+}
@@ -0,0 +1,104 @@
+package iago
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrJumpCycle is returned when the ProxyJump settings of an SSH config lead
+// back to a host that is already part of the jump chain.
+var ErrJumpCycle = errors.New("ProxyJump cycle")
+
+// jumpChain returns the jump hosts through which alias is reached, in dialing
+// order, or an empty chain if alias is dialed directly. As with OpenSSH, the
+// first host of a comma-separated ProxyJump list is reached through its own
+// ProxyJump, if any, while each later host is reached through the one before
+// it, ignoring its own ProxyJump. An alias with a ProxyCommand is reached
+// through the command rather than its ProxyJump, so its chain is empty. This
+// differs from OpenSSH, where whichever of the two directives appears first
+// in the config wins.
+func (cw *sshConfig) jumpChain(alias string) ([]string, error) {
+	return cw.resolveJumps(alias, []string{alias})
+}
+
+// resolveJumps returns the jump chain of alias, where path holds the hosts
+// whose chains are being resolved, from the target down to alias.
+func (cw *sshConfig) resolveJumps(alias string, path []string) ([]string, error) {
+	command, err := cw.rawProxyCommand(alias)
+	if err != nil || command != "" {
+		return nil, err
+	}
+	spec, err := cw.get(alias, "ProxyJump")
+	if err != nil {
+		return nil, err
+	}
+	hops, err := parseProxyJump(spec)
+	if err != nil {
+		return nil, fmt.Errorf("iago: invalid ProxyJump for %s: %w", alias, err)
+	}
+	if len(hops) == 0 {
+		return nil, nil
+	}
+	first := hops[0]
+	if slices.Contains(path, first) {
+		return nil, fmt.Errorf("iago: %s: %w", strings.Join(append(path, first), " -> "), ErrJumpCycle)
+	}
+	chain, err := cw.resolveJumps(first, append(slices.Clip(path), first))
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain, hops...)
+	// The later hops are not resolved, but must not repeat the hosts before
+	// them or lead back to a host whose chain is being resolved.
+	before := len(chain) - len(hops) + 1
+	for i, hop := range hops[1:] {
+		if slices.Contains(path, hop) || slices.Contains(chain[:before+i], hop) {
+			return nil, fmt.Errorf("iago: %s: %w", strings.Join(slices.Concat(path, hops[:i+2]), " -> "), ErrJumpCycle)
+		}
+	}
+	return chain, nil
+}
+
+// parseProxyJump splits a ProxyJump value into its hosts. An empty value and
+// "none" yield no hosts.
+func parseProxyJump(spec string) ([]string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return nil, nil
+	}
+	hops := strings.Split(spec, ",")
+	for i, hop := range hops {
+		hops[i] = strings.TrimSpace(hop)
+		if hops[i] == "" {
+			return nil, fmt.Errorf("empty host in %q", spec)
+		}
+	}
+	return hops, nil
+}
+
+// jumpKey returns the key of the connection to the i-th hop of chain, which
+// identifies the hop together with the hops it is reached through, so that
+// targets share a connection only if they share the whole route to it.
+func jumpKey(chain []string, i int) string {
+	return strings.Join(chain[:i+1], ",")
+}
+
+// dialJump establishes a new SSH connection to the jump host alias, tunnelled
+// through via if it is non-nil. The returned client is a bare [ssh.Client]
+// used only as a tunnel; unlike a target host it has no SFTP sub-client or
+// fetched environment.
+func dialJump(alias string, config *sshConfig, via *ssh.Client) (*ssh.Client, error) {
+	jumpCfg, err := config.ClientConfig(alias)
+	if err != nil {
+		return nil, fmt.Errorf("proxy jump %q: %w", alias, err)
+	}
+	client, err := config.dial(alias, jumpCfg, via)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy jump %q: %w", alias, err)
+	}
+	return client, nil
+}
@@ -0,0 +1,106 @@
+package iago
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestJumpChain(t *testing.T) {
+	config, err := ParseSSHConfig("testdata/config-jumps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		alias     string
+		wantChain []string
+		wantCycle bool
+		wantErr   bool
+	}{
+		{name: "None", alias: "bastion"},
+		{name: "NoneUpperCase", alias: "direct"},
+		{name: "SingleHop", alias: "inner", wantChain: []string{"bastion"}},
+		{name: "Wildcard", alias: "other", wantChain: []string{"bastion"}},
+		{name: "Recursive", alias: "wrk1", wantChain: []string{"bastion", "inner"}},
+		{name: "List", alias: "listed", wantChain: []string{"bastion", "inner"}},
+		{name: "ListFirstHopRecursive", alias: "nested-list", wantChain: []string{"bastion", "inner", "gateway"}},
+		{name: "RecursiveThroughList", alias: "gateway", wantChain: []string{"bastion", "inner", "listed"}},
+		{name: "Cycle", alias: "loop-a", wantCycle: true, wantErr: true},
+		{name: "SelfCycle", alias: "self", wantCycle: true, wantErr: true},
+		{name: "LaterHopCycle", alias: "later-self", wantCycle: true, wantErr: true},
+		{name: "RepeatedHop", alias: "repeated", wantCycle: true, wantErr: true},
+		{name: "EmptyHop", alias: "empty-hop", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := config.jumpChain(tt.alias)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("jumpChain(%s) error = %v, wantErr %v", tt.alias, err, tt.wantErr)
+			}
+			if errors.Is(err, ErrJumpCycle) != tt.wantCycle {
+				t.Errorf("jumpChain(%s) error = %v, want cycle %v", tt.alias, err, tt.wantCycle)
+			}
+			if !slices.Equal(chain, tt.wantChain) {
+				t.Errorf("jumpChain(%s) = %q, want %q", tt.alias, chain, tt.wantChain)
+			}
+		})
+	}
+}
+
+func TestJumpKey(t *testing.T) {
+	chain := []string{"bastion", "inner", "gateway"}
+	for i, want := range []string{"bastion", "bastion,inner", "bastion,inner,gateway"} {
+		if got := jumpKey(chain, i); got != want {
+			t.Errorf("jumpKey(%q, %d) = %q, want %q", chain, i, got, want)
+		}
+	}
+}
+
+func TestGroupDialerJumpFor(t *testing.T) {
+	config, err := ParseSSHConfig("testdata/config-jumps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newGroupDialer(config, nil, groupConfig{})
+	shared := &ssh.Client{}
+	d.jumpClients["bastion"] = &ssh.Client{}
+	d.jumpClients["bastion,inner"] = shared
+	errInner := errors.New("inner unreachable")
+	d.jumpErrs["bastion,inner,gateway"] = errInner
+
+	for _, alias := range []string{"wrk1", "wrk2", "listed"} {
+		if client, err := d.jumpFor(alias); err != nil || client != shared {
+			t.Errorf("jumpFor(%s) = %p, %v, want the shared bastion,inner client", alias, client, err)
+		}
+	}
+	if client, err := d.jumpFor("bastion"); err != nil || client != nil {
+		t.Errorf("jumpFor(bastion) = %p, %v, want a direct dial", client, err)
+	}
+	if _, err := d.jumpFor("nested-list"); !errors.Is(err, errInner) {
+		t.Errorf("jumpFor(nested-list) error = %v, want %v", err, errInner)
+	}
+	if _, err := d.jumpFor("loop-a"); !errors.Is(err, ErrJumpCycle) {
+		t.Errorf("jumpFor(loop-a) error = %v, want %v", err, ErrJumpCycle)
+	}
+	if _, err := d.jumpFor("gateway"); err == nil {
+		t.Error("jumpFor(gateway) succeeded, want error for an unprepared hop")
+	}
+}
+
+func TestPrepareJumpsCycleFailFast(t *testing.T) {
+	config, err := ParseSSHConfig("testdata/config-jumps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := applyGroupOptions(FailFast())
+	d := newGroupDialer(config, []string{"bastion", "self"}, cfg)
+	if err := d.prepareJumps(cfg); !errors.Is(err, ErrJumpCycle) {
+		t.Errorf("prepareJumps() error = %v, want %v", err, ErrJumpCycle)
+	}
+	if len(d.jumpClients) != 0 {
+		t.Errorf("prepareJumps() dialed %d jump hosts, want 0", len(d.jumpClients))
+	}
+}
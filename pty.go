@@ -0,0 +1,215 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"golang.org/x/term"
+)
+
+// ErrPTYUnsupported is returned when a pseudo-terminal is requested from a
+// [CmdRunner] that cannot allocate one.
+var ErrPTYUnsupported = errors.New("command runner does not support pseudo-terminals")
+
+// PTY describes a pseudo-terminal to allocate for a remote command. Programs
+// that require a terminal, such as some installers or sudo with requiretty,
+// need one to run. With a PTY, the server also delivers SIGHUP to the remote
+// process when the connection closes, instead of leaving it running.
+//
+// The server merges the command's standard error into its standard output
+// when a PTY is allocated.
+type PTY struct {
+	// Term is the terminal type, such as "xterm-256color"; empty means "xterm".
+	Term string
+	// Width and Height are the terminal size in characters; zero means 80x24.
+	Width, Height int
+	// Modes holds terminal modes keyed by the opcodes of RFC 4254, section 8,
+	// such as ssh.ECHO; nil leaves the server defaults.
+	Modes map[uint8]uint32
+	// Resize, if non-nil, forwards each size received on it to the remote
+	// terminal while the command runs.
+	Resize <-chan WindowSize
+}
+
+// WindowSize is the size of a terminal in characters.
+type WindowSize struct {
+	Width, Height int
+}
+
+// withDefaults returns p with the zero-valued fields set to their defaults.
+func (p PTY) withDefaults() PTY {
+	if p.Term == "" {
+		p.Term = "xterm"
+	}
+	if p.Width <= 0 {
+		p.Width = 80
+	}
+	if p.Height <= 0 {
+		p.Height = 24
+	}
+	return p
+}
+
+// ptyRunner is implemented by a [CmdRunner] that can allocate a
+// pseudo-terminal for its command.
+type ptyRunner interface {
+	// RequestPty allocates a pseudo-terminal; it must be called before the
+	// command starts.
+	RequestPty(pty PTY) error
+	// WindowChange informs the remote terminal that its size has changed.
+	WindowChange(size WindowSize) error
+	// StartShell starts the user's login shell instead of a command.
+	StartShell() error
+}
+
+// NewCommandWithPTY returns a new command runner for host with a
+// pseudo-terminal allocated as described by pty. Window size changes on
+// pty.Resize are not forwarded; use [Shell.PTY] for that.
+func NewCommandWithPTY(host Host, pty PTY) (CmdRunner, error) {
+	cmd, err := host.NewCommand()
+	if err != nil {
+		return nil, err
+	}
+	if err := requestPty(cmd, pty); err != nil {
+		closeCmd(cmd)
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// requestPty allocates a pseudo-terminal for cmd.
+func requestPty(cmd CmdRunner, pty PTY) error {
+	pr, ok := cmd.(ptyRunner)
+	if !ok {
+		return ErrPTYUnsupported
+	}
+	return pr.RequestPty(pty.withDefaults())
+}
+
+// forwardResize forwards window sizes received on resize to cmd until done is
+// closed. A failed window change is not fatal to the command and is ignored.
+func forwardResize(cmd CmdRunner, resize <-chan WindowSize, done <-chan struct{}) {
+	pr, ok := cmd.(ptyRunner)
+	if !ok {
+		return
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case size, ok := <-resize:
+			if !ok {
+				return
+			}
+			_ = pr.WindowChange(size)
+		}
+	}
+}
+
+// closeCmd closes cmd if it holds resources that must be released when it is
+// abandoned before running, such as an SSH session.
+func closeCmd(cmd CmdRunner) {
+	if c, ok := cmd.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// Interactive attaches the local terminal to a login shell on host, for
+// debugging a single host in the middle of a run. It puts the local terminal
+// in raw mode, allocates a remote pseudo-terminal of the same type and size,
+// forwards window size changes, and returns when the remote shell exits or
+// ctx is done. Standard input must be a terminal.
+func Interactive(ctx context.Context, host Host) (err error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("iago: interactive session requires a terminal on standard input")
+	}
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		return fmt.Errorf("iago: failed to get terminal size: %w", err)
+	}
+
+	cmd, err := NewCommandWithPTY(host, PTY{Term: os.Getenv("TERM"), Width: width, Height: height})
+	if err != nil {
+		return err
+	}
+	defer closeCmd(cmd)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("iago: failed to put terminal in raw mode: %w", err)
+	}
+	defer func() { err = errors.Join(err, term.Restore(fd, state)) }()
+
+	if err := cmd.(ptyRunner).StartShell(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go forwardResize(cmd, localResize(fd, done), done)
+	stdin := openStdin()
+	// Closing stdin stops the copy from standard input, so that it does not
+	// consume the next keystroke after the shell exits. The output copy ends
+	// when the session is closed and is awaited before the terminal is
+	// restored, so that trailing output is not lost.
+	outDone := make(chan struct{})
+	defer func() {
+		_ = stdin.Close()
+		<-outDone
+	}()
+	go func() { _, _ = io.Copy(in, stdin) }()
+	go func() {
+		defer close(outDone)
+		_, _ = io.Copy(os.Stdout, out)
+	}()
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	select {
+	case err := <-waitErr:
+		return err
+	case <-ctx.Done():
+		closeCmd(cmd)
+		return ctx.Err()
+	}
+}
+
+// localResize returns a channel that receives the size of the local terminal
+// fd whenever it changes, until done is closed.
+func localResize(fd int, done <-chan struct{}) <-chan WindowSize {
+	resize := make(chan WindowSize)
+	sigs := make(chan os.Signal, 1)
+	notifyResize(sigs)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigs:
+				width, height, err := term.GetSize(fd)
+				if err != nil {
+					continue
+				}
+				select {
+				case resize <- WindowSize{Width: width, Height: height}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return resize
+}
@@ -0,0 +1,56 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakePtyRunner is a fakeCmdRunner that supports pseudo-terminals. Its
+// RunContext returns once the first window change has been received, so tests
+// can observe resize forwarding while the command "runs".
+type fakePtyRunner struct {
+	fakeCmdRunner
+	pty     PTY
+	resized chan WindowSize
+}
+
+func (r *fakePtyRunner) RequestPty(pty PTY) error { r.pty = pty; return nil }
+func (r *fakePtyRunner) StartShell() error        { return nil }
+func (r *fakePtyRunner) WindowChange(size WindowSize) error {
+	r.resized <- size
+	return nil
+}
+
+func (r *fakePtyRunner) RunContext(ctx context.Context, cmd string) error {
+	select {
+	case <-r.resized:
+	case <-time.After(time.Second):
+		return errors.New("no window change received")
+	}
+	return r.fakeCmdRunner.RunContext(ctx, cmd)
+}
+
+func TestShellPTY(t *testing.T) {
+	runner := &fakePtyRunner{resized: make(chan WindowSize)}
+	host := fakeHost{name: "h", cmd: runner}
+	resize := make(chan WindowSize, 1)
+	resize <- WindowSize{Width: 120, Height: 40}
+	err := Shell{Command: "top -b -n 1", PTY: &PTY{Resize: resize}}.Apply(context.Background(), host)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := PTY{Term: "xterm", Width: 80, Height: 24}
+	if runner.pty.Term != want.Term || runner.pty.Width != want.Width || runner.pty.Height != want.Height {
+		t.Errorf("requested PTY = %+v, want %+v", runner.pty, want)
+	}
+}
+
+func TestShellPTYUnsupported(t *testing.T) {
+	host := fakeHost{name: "h", cmd: &fakeCmdRunner{}}
+	err := Shell{Command: "true", PTY: &PTY{}}.Apply(context.Background(), host)
+	if !errors.Is(err, ErrPTYUnsupported) {
+		t.Fatalf("Apply error = %v, want %v", err, ErrPTYUnsupported)
+	}
+}
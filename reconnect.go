@@ -0,0 +1,305 @@
+package iago
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	fs "github.com/relab/wrfs"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrHostClosed is returned when a closed host is used.
+var ErrHostClosed = errors.New("host closed")
+
+// ReconnectPolicy makes the hosts of a group reconnect when their connection
+// drops, for example after a keepalive failure (see [KeepAlive]) or a restart
+// of the remote sshd. A host that finds its connection lost when a new
+// command is started, or when its file system is requested, dials its alias
+// again, through the group's shared ProxyJump connections if it has any, which
+// are themselves re-dialed if they were lost. The SFTP client, agent
+// forwarding and the port forwards of the SSH config are set up again, and
+// host variables are kept. Commands that were running when the connection
+// dropped still fail.
+type ReconnectPolicy struct {
+	// MaxAttempts is the number of dials attempted per reconnection; zero
+	// means 3.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, doubled before each
+	// further attempt; zero means one second.
+	Backoff time.Duration
+	// OnReconnect, if non-nil, is called after each attempt, with the error
+	// of the attempt or nil if it succeeded.
+	OnReconnect func(ReconnectEvent)
+}
+
+// ReconnectEvent describes an attempt to reconnect a host.
+type ReconnectEvent struct {
+	// Host is the name of the host.
+	Host string
+	// Attempt is the number of the attempt, starting at 1.
+	Attempt int
+	// Err is the error of the attempt, or nil if it succeeded.
+	Err error
+}
+
+func (p ReconnectPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return 3
+	}
+	return p.MaxAttempts
+}
+
+func (p ReconnectPolicy) backoff() time.Duration {
+	if p.Backoff <= 0 {
+		return time.Second
+	}
+	return p.Backoff
+}
+
+// Reconnect returns a [GroupOption] that makes the hosts dialed by
+// [NewSSHGroup] reconnect according to policy when their connection drops.
+func Reconnect(policy ReconnectPolicy) GroupOption {
+	return func(cfg *groupConfig) {
+		cfg.reconnect = &policy
+	}
+}
+
+// connHost is a [Host] whose connection can be checked, such as [sshHost].
+type connHost interface {
+	Host
+	connected(probe bool) bool
+}
+
+// reconnectingHost is a [Host] that dials its connection again when it is
+// lost. Its variables belong to the wrapper, so that they survive reconnects.
+type reconnectingHost struct {
+	Vars
+	name   string
+	policy ReconnectPolicy
+	redial func() (connHost, error)
+
+	// reconnecting serializes reconnects. It is held across the backoff and
+	// the dials, while mu is only held to read or replace host, so that the
+	// host stays usable while it reconnects.
+	reconnecting sync.Mutex
+
+	mu       sync.Mutex
+	host     connHost
+	closed   bool
+	forwards forwardSet // port forwards started on the wrapper, closed by Close
+}
+
+func newReconnectingHost(host connHost, policy ReconnectPolicy, redial func() (connHost, error)) *reconnectingHost {
+	return &reconnectingHost{name: host.Name(), policy: policy, redial: redial, host: host}
+}
+
+// current returns the current connection.
+func (h *reconnectingHost) current() connHost {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.host
+}
+
+// reconnect replaces the connection stale with a new one, unless another
+// caller already did so.
+func (h *reconnectingHost) reconnect(stale connHost) error {
+	h.reconnecting.Lock()
+	defer h.reconnecting.Unlock()
+	if h.current() != stale {
+		return nil
+	}
+	// The lost connection is closed first, so that the port forwards of the
+	// SSH config can listen on the same local ports again.
+	_ = stale.Close()
+	var errs []error
+	wait := h.policy.backoff()
+	for attempt := 1; attempt <= h.policy.maxAttempts(); attempt++ {
+		if attempt > 1 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		if h.isClosed() {
+			return fmt.Errorf("iago: %s: %w", h.name, ErrHostClosed)
+		}
+		host, err := h.redial()
+		if h.policy.OnReconnect != nil {
+			h.policy.OnReconnect(ReconnectEvent{Host: h.name, Attempt: attempt, Err: err})
+		}
+		if err == nil {
+			return h.replace(host)
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("iago: failed to reconnect %s: %w", h.name, errors.Join(errs...))
+}
+
+// isClosed reports whether the host has been closed.
+func (h *reconnectingHost) isClosed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+// replace makes host the current connection, or closes it if the host was
+// closed while it was dialed.
+func (h *reconnectingHost) replace(host connHost) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		_ = host.Close()
+		return fmt.Errorf("iago: %s: %w", h.name, ErrHostClosed)
+	}
+	h.host = host
+	return nil
+}
+
+func (h *reconnectingHost) Name() string {
+	return h.name
+}
+
+func (h *reconnectingHost) Address() string {
+	return h.current().Address()
+}
+
+func (h *reconnectingHost) GetEnv(key string) string {
+	return h.current().GetEnv(key)
+}
+
+// GetFS returns the file system of the host, reconnecting first if the
+// connection is known to be lost. If reconnecting fails, the file system of
+// the lost connection is returned, whose operations fail.
+func (h *reconnectingHost) GetFS() fs.FS {
+	host := h.current()
+	if !host.connected(false) && h.reconnect(host) == nil {
+		host = h.current()
+	}
+	return host.GetFS()
+}
+
+// NewCommand returns a new command runner for the host, reconnecting and
+// retrying once if the connection has been lost.
+func (h *reconnectingHost) NewCommand() (CmdRunner, error) {
+	host := h.current()
+	if host.connected(false) {
+		cmd, err := host.NewCommand()
+		if err == nil || host.connected(true) {
+			return cmd, err
+		}
+	}
+	if err := h.reconnect(host); err != nil {
+		return nil, err
+	}
+	return h.current().NewCommand()
+}
+
+func (h *reconnectingHost) Close() error {
+	forwardErr := h.forwards.close()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	return errors.Join(forwardErr, h.host.Close())
+}
+
+// live returns the current connection, reconnecting first if it is known to
+// be lost.
+func (h *reconnectingHost) live() (connHost, error) {
+	host := h.current()
+	if host.connected(false) {
+		return host, nil
+	}
+	if err := h.reconnect(host); err != nil {
+		return nil, err
+	}
+	return h.current(), nil
+}
+
+// DialContext connects to addr on network from the remote host, through the
+// current connection, so that dialers and local and dynamic forwards keep
+// working after a reconnect.
+func (h *reconnectingHost) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, err := h.live()
+	if err != nil {
+		return nil, err
+	}
+	d, ok := host.(Dialer)
+	if !ok {
+		return nil, fmt.Errorf("iago: %s: %w", h.Name(), errors.ErrUnsupported)
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+func (h *reconnectingHost) listenRemote(addr string) (net.Listener, error) {
+	host, err := h.live()
+	if err != nil {
+		return nil, err
+	}
+	pf, ok := host.(portForwarder)
+	if !ok {
+		return nil, ErrForwardUnsupported
+	}
+	return pf.listenRemote(addr)
+}
+
+func (h *reconnectingHost) forwardSet() *forwardSet {
+	return &h.forwards
+}
+
+// jumpPool holds the ProxyJump connections shared by the hosts of a group,
+// keyed by [jumpKey]. Hosts that reconnect get the connection from the pool,
+// which dials lost hops of the chain again. Closing the pool closes the
+// current connections.
+type jumpPool struct {
+	config  *sshConfig
+	mu      sync.Mutex
+	clients map[string]*ssh.Client
+}
+
+// client returns a live connection to the last hop of chain, dialing again
+// every hop whose connection was lost. Hops tunnelled through a lost hop are
+// lost with it and dialed again through the new connection.
+func (p *jumpPool) client(chain []string) (*ssh.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var via *ssh.Client
+	for i, hop := range chain {
+		key := jumpKey(chain, i)
+		if c := p.clients[key]; c != nil {
+			if _, _, err := c.SendRequest(keepAliveRequest, true, nil); err == nil {
+				via = c
+				continue
+			}
+			_ = c.Close()
+			delete(p.clients, key)
+		}
+		c, err := dialJump(hop, p.config, via)
+		if err != nil {
+			return nil, err
+		}
+		p.clients[key] = c
+		via = c
+	}
+	return via, nil
+}
+
+// Close closes the connections, the innermost hops first, since closing a
+// hop tears down the connections tunnelled through it.
+func (p *jumpPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := slices.SortedFunc(maps.Keys(p.clients), func(a, b string) int {
+		return cmp.Compare(strings.Count(b, ","), strings.Count(a, ","))
+	})
+	var errs []error
+	for _, key := range keys {
+		errs = append(errs, p.clients[key].Close())
+	}
+	return errors.Join(errs...)
+}
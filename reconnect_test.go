@@ -0,0 +1,196 @@
+package iago
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/relab/wrfs"
+)
+
+// fakeConnHost is a fakeHost whose connection can be dropped.
+type fakeConnHost struct {
+	fakeHost
+	up     atomic.Bool
+	closed atomic.Bool
+}
+
+func newFakeConnHost(name string) *fakeConnHost {
+	h := &fakeConnHost{fakeHost: fakeHost{name: name, cmd: &fakeCmdRunner{}, fsys: wrfs.DirFS("/")}}
+	h.up.Store(true)
+	return h
+}
+
+func (h *fakeConnHost) NewCommand() (CmdRunner, error) {
+	if !h.up.Load() {
+		return nil, errors.New("connection lost")
+	}
+	return h.fakeHost.NewCommand()
+}
+
+func (h *fakeConnHost) Close() error {
+	h.closed.Store(true)
+	return nil
+}
+
+func (h *fakeConnHost) connected(bool) bool { return h.up.Load() }
+
+// fakeRedialer returns hosts from a list of dial results, recording each
+// attempt.
+type fakeRedialer struct {
+	mu      sync.Mutex
+	results []error
+	dialed  []*fakeConnHost
+}
+
+func (r *fakeRedialer) redial() (connHost, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.results) > 0 {
+		err := r.results[0]
+		r.results = r.results[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	h := newFakeConnHost("wrk1")
+	r.dialed = append(r.dialed, h)
+	return h, nil
+}
+
+func (r *fakeRedialer) dials() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.dialed)
+}
+
+func TestReconnectingHostLive(t *testing.T) {
+	r := &fakeRedialer{}
+	h := newReconnectingHost(newFakeConnHost("wrk1"), ReconnectPolicy{}, r.redial)
+	if _, err := h.NewCommand(); err != nil {
+		t.Fatal(err)
+	}
+	_ = h.GetFS()
+	if r.dials() != 0 {
+		t.Errorf("live host redialed %d times, want 0", r.dials())
+	}
+}
+
+func TestReconnectingHostReconnects(t *testing.T) {
+	first := newFakeConnHost("wrk1")
+	r := &fakeRedialer{results: []error{errors.New("refused"), nil}}
+	var events []ReconnectEvent
+	policy := ReconnectPolicy{Backoff: time.Millisecond, OnReconnect: func(e ReconnectEvent) { events = append(events, e) }}
+	h := newReconnectingHost(first, policy, r.redial)
+	h.SetVar("role", "leader")
+
+	first.up.Store(false)
+	if _, err := h.NewCommand(); err != nil {
+		t.Fatalf("NewCommand() after drop error = %v", err)
+	}
+	if !first.closed.Load() {
+		t.Error("lost connection was not closed")
+	}
+	if h.current() != r.dialed[0] {
+		t.Error("host does not use the new connection")
+	}
+	if len(events) != 2 || events[0].Err == nil || events[1].Err != nil || events[1].Attempt != 2 || events[1].Host != "wrk1" {
+		t.Errorf("events = %+v, want a failed attempt 1 and a successful attempt 2", events)
+	}
+	if got := GetStringVar(h, "role"); got != "leader" {
+		t.Errorf("role = %q after reconnect, want leader", got)
+	}
+
+	// GetFS reconnects too.
+	r.dialed[0].up.Store(false)
+	_ = h.GetFS()
+	if r.dials() != 2 {
+		t.Errorf("GetFS() after drop dialed %d times in total, want 2", r.dials())
+	}
+}
+
+func TestReconnectingHostGivesUp(t *testing.T) {
+	first := newFakeConnHost("wrk1")
+	r := &fakeRedialer{results: []error{errors.New("a"), errors.New("b")}}
+	h := newReconnectingHost(first, ReconnectPolicy{MaxAttempts: 2, Backoff: time.Millisecond}, r.redial)
+	first.up.Store(false)
+	if _, err := h.NewCommand(); err == nil {
+		t.Fatal("NewCommand() succeeded, want error after failed reconnect")
+	}
+	if h.current() != first {
+		t.Error("host replaced its connection after failed reconnect")
+	}
+}
+
+func TestReconnectingHostConcurrent(t *testing.T) {
+	first := newFakeConnHost("wrk1")
+	r := &fakeRedialer{}
+	h := newReconnectingHost(first, ReconnectPolicy{}, r.redial)
+	first.up.Store(false)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if _, err := h.NewCommand(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if r.dials() != 1 {
+		t.Errorf("concurrent commands redialed %d times, want 1", r.dials())
+	}
+}
+
+func TestReconnectingHostUsableWhileReconnecting(t *testing.T) {
+	first := newFakeConnHost("wrk1")
+	r := &fakeRedialer{results: []error{errors.New("refused"), nil}}
+	failed := make(chan struct{})
+	policy := ReconnectPolicy{Backoff: time.Minute, OnReconnect: func(e ReconnectEvent) {
+		if e.Attempt == 1 {
+			close(failed)
+		}
+	}}
+	h := newReconnectingHost(first, policy, r.redial)
+	first.up.Store(false)
+	go func() { _, _ = h.NewCommand() }()
+	<-failed
+
+	// The reconnect is now waiting out the backoff.
+	done := make(chan struct{})
+	go func() {
+		_ = h.Address()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Address() blocked during the reconnect backoff")
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconnectingHostClosed(t *testing.T) {
+	first := newFakeConnHost("wrk1")
+	h := newReconnectingHost(first, ReconnectPolicy{}, (&fakeRedialer{}).redial)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	first.up.Store(false)
+	if _, err := h.NewCommand(); !errors.Is(err, ErrHostClosed) {
+		t.Errorf("NewCommand() on closed host error = %v, want %v", err, ErrHostClosed)
+	}
+}
+
+func TestReconnectOption(t *testing.T) {
+	if cfg := applyGroupOptions(); cfg.reconnect != nil {
+		t.Errorf("default reconnect = %+v, want nil", cfg.reconnect)
+	}
+	cfg := applyGroupOptions(Reconnect(ReconnectPolicy{MaxAttempts: 5}))
+	if cfg.reconnect == nil || cfg.reconnect.maxAttempts() != 5 || cfg.reconnect.backoff() != time.Second {
+		t.Errorf("reconnect = %+v, want 5 attempts with the default backoff", cfg.reconnect)
+	}
+}
@@ -0,0 +1,312 @@
+package iago
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	fs "github.com/relab/wrfs"
+)
+
+// ServiceAction is a systemctl(1) command that changes the state of a unit.
+type ServiceAction string
+
+const (
+	// ServiceStart starts the unit.
+	ServiceStart ServiceAction = "start"
+	// ServiceStop stops the unit.
+	ServiceStop ServiceAction = "stop"
+	// ServiceRestart restarts the unit, starting it if it is not running.
+	ServiceRestart ServiceAction = "restart"
+	// ServiceReload reloads the configuration of the unit.
+	ServiceReload ServiceAction = "reload"
+	// ServiceEnable enables the unit to start at boot.
+	ServiceEnable ServiceAction = "enable"
+	// ServiceDisable disables the unit from starting at boot.
+	ServiceDisable ServiceAction = "disable"
+)
+
+// Service manages a systemd unit on a remote host with systemctl(1):
+//
+//	g.Run("restart replica", iago.Service{Name: "replica", Action: iago.ServiceRestart, Become: &iago.Become{}}.Apply)
+//
+// Its [Service.Status] and [Service.IsActive] methods query the state of the
+// unit without changing it.
+type Service struct {
+	// Name is the name of the unit, such as "nginx" or "replica.service".
+	Name string
+	// Action is what [Service.Apply] does to the unit.
+	Action ServiceAction
+	// Now also starts the unit on [ServiceEnable], and stops it on
+	// [ServiceDisable].
+	Now bool
+	// User manages the unit in the service manager of the SSH user
+	// (systemctl --user) instead of the system.
+	User bool
+	// Become, if non-nil, runs systemctl as another user, usually root.
+	Become *Become
+}
+
+// ServiceStatus is the state of a systemd unit, as reported by
+// systemctl show.
+type ServiceStatus struct {
+	// Name is the primary name of the unit, such as "nginx.service".
+	Name        string
+	Description string
+	// LoadState is whether the unit file was loaded, such as "loaded" or
+	// "not-found".
+	LoadState string
+	// ActiveState is the high-level state of the unit, such as "active",
+	// "inactive", "activating" or "failed".
+	ActiveState string
+	// SubState is the unit-type-specific state, such as "running" or "exited".
+	SubState string
+	// UnitFileState is whether the unit is enabled, such as "enabled",
+	// "disabled" or "static".
+	UnitFileState string
+	// MainPID is the process ID of the main process, or 0 if none.
+	MainPID int
+	// ExecMainStatus is the exit status of the last main process.
+	ExecMainStatus int
+	// NRestarts is the number of automatic restarts since the unit was started.
+	NRestarts int
+}
+
+// Active reports whether the unit is active.
+func (s ServiceStatus) Active() bool {
+	return s.ActiveState == "active"
+}
+
+// Enabled reports whether the unit is enabled to start at boot.
+func (s ServiceStatus) Enabled() bool {
+	return s.UnitFileState == "enabled" || s.UnitFileState == "enabled-runtime"
+}
+
+// serviceProperties are the unit properties queried by [Service.Status].
+var serviceProperties = []string{
+	"Id", "Description", "LoadState", "ActiveState", "SubState",
+	"UnitFileState", "MainPID", "ExecMainStatus", "NRestarts",
+}
+
+// systemctl returns the systemctl command line for args and the unit name.
+func (s Service) systemctl(args ...string) string {
+	cmd := []string{"systemctl"}
+	if s.User {
+		cmd = append(cmd, "--user")
+	}
+	cmd = append(cmd, args...)
+	return strings.Join(append(cmd, "--", Quote(s.Name)), " ")
+}
+
+// shell returns a Shell running cmd as s's user.
+func (s Service) shell(cmd string) Shell {
+	return Shell{Command: cmd, Become: s.Become}
+}
+
+// Apply performs s.Action on the unit on host.
+func (s Service) Apply(ctx context.Context, host Host) error {
+	var args []string
+	switch s.Action {
+	case ServiceStart, ServiceStop, ServiceRestart, ServiceReload:
+		args = []string{string(s.Action)}
+	case ServiceEnable, ServiceDisable:
+		args = []string{string(s.Action)}
+		if s.Now {
+			args = append(args, "--now")
+		}
+	default:
+		return fmt.Errorf("iago: unknown service action %q", s.Action)
+	}
+	if err := s.shell(s.systemctl(args...)).Apply(ctx, host); err != nil {
+		return fmt.Errorf("iago: failed to %s %s: %w", s.Action, s.Name, err)
+	}
+	return nil
+}
+
+// Status returns the state of the unit on host. A unit that does not exist is
+// reported with a LoadState of "not-found" rather than an error.
+func (s Service) Status(ctx context.Context, host Host) (ServiceStatus, error) {
+	var out bytes.Buffer
+	sa := s.shell(s.systemctl("show", "-p", strings.Join(serviceProperties, ",")))
+	sa.Stdout = &out
+	if err := sa.Apply(ctx, host); err != nil {
+		return ServiceStatus{}, fmt.Errorf("iago: failed to get status of %s: %w", s.Name, err)
+	}
+	return parseServiceStatus(out.String())
+}
+
+// parseServiceStatus parses the key=value lines printed by systemctl show.
+func parseServiceStatus(out string) (status ServiceStatus, err error) {
+	for line := range strings.Lines(out) {
+		key, val, ok := strings.Cut(strings.TrimRight(line, "\r\n"), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Id":
+			status.Name = val
+		case "Description":
+			status.Description = val
+		case "LoadState":
+			status.LoadState = val
+		case "ActiveState":
+			status.ActiveState = val
+		case "SubState":
+			status.SubState = val
+		case "UnitFileState":
+			status.UnitFileState = val
+		case "MainPID":
+			status.MainPID, err = parseServiceInt(key, val)
+		case "ExecMainStatus":
+			status.ExecMainStatus, err = parseServiceInt(key, val)
+		case "NRestarts":
+			status.NRestarts, err = parseServiceInt(key, val)
+		}
+		if err != nil {
+			return ServiceStatus{}, err
+		}
+	}
+	return status, nil
+}
+
+// parseServiceInt parses the integer value of a unit property; empty values,
+// which older versions of systemd print for unknown properties, are zero.
+func parseServiceInt(key, val string) (int, error) {
+	if val == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("iago: invalid %s %q: %w", key, val, err)
+	}
+	return i, nil
+}
+
+// IsActive reports whether the unit is active on host, using
+// systemctl is-active. Exit statuses other than those systemctl uses for an
+// inactive or unknown unit, such as a failure of Become, are errors.
+func (s Service) IsActive(ctx context.Context, host Host) (bool, error) {
+	err := s.shell(s.systemctl("is-active", "--quiet")).Apply(ctx, host)
+	if err == nil {
+		return true, nil
+	}
+	if status, ok := errors.AsType[ExitStatus](err); ok {
+		switch status.ExitStatus() {
+		case 3, 4: // inactive, or no such unit
+			return false, nil
+		}
+	}
+	return false, err
+}
+
+// UnitFile installs a systemd unit file rendered from a [text/template], and
+// reloads the systemd configuration if the unit changed:
+//
+//	iago.UnitFile{
+//		Name:     "replica.service",
+//		Template: "[Service]\nExecStart={{.Bin}} --id {{.ID}}\n",
+//		Data:     map[string]any{"Bin": "/opt/bench/replica", "ID": 1},
+//		Become:   &iago.Become{},
+//	}
+//
+// Installing a unit identical to the one on the host does nothing, so that
+// later tasks restart a service only when its definition changed. Templates
+// can query the host with the functions of [TemplateFuncs], such as
+// {{(facts).CPUs}}.
+type UnitFile struct {
+	// Name is the file name of the unit, such as "replica.service".
+	Name string
+	// Template is the text of the unit file, as a [text/template].
+	Template string
+	// Data is passed to Template when it is executed.
+	Data any
+	// Dir is the directory to install the unit in; empty means
+	// /etc/systemd/system, or $HOME/.config/systemd/user if User is set.
+	Dir string
+	// User installs the unit for the service manager of the SSH user, which
+	// is reloaded with systemctl --user. It cannot be combined with a Become
+	// as root, whose systemctl --user would reload root's service manager.
+	User bool
+	// Become, if non-nil, installs the unit and reloads systemd as another
+	// user, usually root.
+	Become *Become
+}
+
+// Apply installs the unit file on host. It satisfies the task signature of
+// [Group.Run].
+func (u UnitFile) Apply(ctx context.Context, host Host) error {
+	_, err := u.Install(ctx, host)
+	return err
+}
+
+// Install installs the unit file on host and runs systemctl daemon-reload if
+// the unit changed. It reports whether the unit changed.
+func (u UnitFile) Install(ctx context.Context, host Host) (changed bool, err error) {
+	if u.Name == "" || strings.Contains(u.Name, "/") {
+		return false, fmt.Errorf("iago: invalid unit name %q", u.Name)
+	}
+	if u.User && u.Become != nil && (u.Become.User == "" || u.Become.User == "root") {
+		return false, fmt.Errorf("iago: user unit %s cannot be installed as root", u.Name)
+	}
+	content, err := u.render(ctx, host)
+	if err != nil {
+		return false, err
+	}
+	dir := u.Dir
+	switch {
+	case dir != "":
+	case u.User:
+		home := Expand(host, "$HOME")
+		if home == "" {
+			return false, fmt.Errorf("iago: failed to install user unit %s: HOME is not set", u.Name)
+		}
+		dir = path.Join(home, ".config/systemd/user")
+	default:
+		dir = "/etc/systemd/system"
+	}
+	target := path.Join(dir, u.Name)
+
+	current, err := fs.ReadFile(host.GetFS(), removeSlash(target))
+	if err == nil && bytes.Equal(current, content) {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("iago: failed to read unit %s: %w", target, err)
+	}
+
+	// The unit is written to a temporary file and renamed into place, so that
+	// systemd never reads a partially written unit.
+	tmp := target + ".iago-tmp"
+	install := fmt.Sprintf("mkdir -p %s && cat > %s && chmod 644 %s && mv -f %s %s",
+		Quote(dir), Quote(tmp), Quote(tmp), Quote(tmp), Quote(target))
+	err = Shell{Command: install, Stdin: bytes.NewReader(content), Become: u.Become}.Apply(ctx, host)
+	if err != nil {
+		return false, fmt.Errorf("iago: failed to install unit %s: %w", target, err)
+	}
+	reload := "systemctl daemon-reload"
+	if u.User {
+		reload = "systemctl --user daemon-reload"
+	}
+	if err := (Shell{Command: reload, Become: u.Become}).Apply(ctx, host); err != nil {
+		return true, fmt.Errorf("iago: failed to reload systemd: %w", err)
+	}
+	return true, nil
+}
+
+// render executes the unit template for host.
+func (u UnitFile) render(ctx context.Context, host Host) ([]byte, error) {
+	tmpl, err := template.New(u.Name).Option("missingkey=error").Funcs(TemplateFuncs(ctx, host)).Parse(u.Template)
+	if err != nil {
+		return nil, fmt.Errorf("iago: invalid template for unit %s: %w", u.Name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, u.Data); err != nil {
+		return nil, fmt.Errorf("iago: failed to render unit %s: %w", u.Name, err)
+	}
+	return buf.Bytes(), nil
+}
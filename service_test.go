@@ -0,0 +1,190 @@
+package iago
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/relab/wrfs"
+)
+
+func TestServiceApply(t *testing.T) {
+	tests := []struct {
+		svc     Service
+		want    string
+		wantErr bool
+	}{
+		{svc: Service{Name: "nginx", Action: ServiceStart}, want: "systemctl start -- 'nginx'"},
+		{svc: Service{Name: "nginx", Action: ServiceReload}, want: "systemctl reload -- 'nginx'"},
+		{svc: Service{Name: "replica.service", Action: ServiceEnable, Now: true}, want: "systemctl enable --now -- 'replica.service'"},
+		{svc: Service{Name: "replica", Action: ServiceDisable, User: true}, want: "systemctl --user disable -- 'replica'"},
+		{svc: Service{Name: "nginx", Action: "frobnicate"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		runner := &fakeCmdRunner{}
+		err := tt.svc.Apply(context.Background(), fakeHost{name: "wrk1", cmd: runner})
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("Apply(%+v) error = %v, wantErr %v", tt.svc, err, tt.wantErr)
+		}
+		if runner.cmd != tt.want {
+			t.Errorf("Apply(%+v) ran %q, want %q", tt.svc, runner.cmd, tt.want)
+		}
+	}
+}
+
+func TestParseServiceStatus(t *testing.T) {
+	out := `Id=replica.service
+Description=Benchmark replica
+LoadState=loaded
+ActiveState=active
+SubState=running
+UnitFileState=enabled
+MainPID=1234
+ExecMainStatus=0
+NRestarts=2
+`
+	got, err := parseServiceStatus(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ServiceStatus{
+		Name:          "replica.service",
+		Description:   "Benchmark replica",
+		LoadState:     "loaded",
+		ActiveState:   "active",
+		SubState:      "running",
+		UnitFileState: "enabled",
+		MainPID:       1234,
+		NRestarts:     2,
+	}
+	if got != want {
+		t.Errorf("parseServiceStatus() = %+v, want %+v", got, want)
+	}
+	if !got.Active() || !got.Enabled() {
+		t.Errorf("Active() = %t, Enabled() = %t, want true, true", got.Active(), got.Enabled())
+	}
+
+	got, err = parseServiceStatus("Id=missing.service\nLoadState=not-found\nMainPID=\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LoadState != "not-found" || got.MainPID != 0 || got.Active() {
+		t.Errorf("parseServiceStatus() = %+v, want not-found and inactive", got)
+	}
+
+	if _, err := parseServiceStatus("MainPID=abc\n"); err == nil {
+		t.Error("parseServiceStatus() with invalid MainPID succeeded, want error")
+	}
+}
+
+func TestServiceIsActive(t *testing.T) {
+	tests := []struct {
+		err     error
+		want    bool
+		wantErr bool
+	}{
+		{err: nil, want: true},
+		{err: fakeExitError{status: 3}, want: false},
+		{err: fakeExitError{status: 4}, want: false},
+		{err: fakeExitError{status: 1}, wantErr: true},
+		{err: os.ErrDeadlineExceeded, wantErr: true},
+	}
+	for _, tt := range tests {
+		host := fakeHost{name: "wrk1", cmd: &fakeCmdRunner{err: tt.err}}
+		got, err := Service{Name: "nginx"}.IsActive(context.Background(), host)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("IsActive() with %v = %t, %v; want %t, wantErr %t", tt.err, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestUnitFileInstall(t *testing.T) {
+	root := t.TempDir()
+	unit := UnitFile{
+		Name:     "replica.service",
+		Template: "[Service]\nExecStart={{.Bin}} --id {{.ID}}\n",
+		Data:     map[string]any{"Bin": "/opt/replica", "ID": 1},
+	}
+	const want = "[Service]\nExecStart=/opt/replica --id 1\n"
+
+	runner := &fakeCmdRunner{stdin: &strings.Builder{}}
+	host := fakeHost{name: "wrk1", cmd: runner, fsys: wrfs.DirFS(root)}
+	changed, err := unit.Install(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("Install() of a new unit reported no change")
+	}
+	if runner.stdin.String() != want {
+		t.Errorf("Install() wrote %q, want %q", runner.stdin.String(), want)
+	}
+	if runner.cmd != "systemctl daemon-reload" {
+		t.Errorf("Install() last ran %q, want daemon-reload", runner.cmd)
+	}
+
+	// Simulate the installed unit, which Install should leave alone.
+	dir := filepath.Join(root, "etc", "systemd", "system")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "replica.service"), []byte(want), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner = &fakeCmdRunner{stdin: &strings.Builder{}}
+	host.cmd = runner
+	changed, err = unit.Install(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || runner.cmd != "" {
+		t.Errorf("Install() of an unchanged unit = %t and ran %q, want no change", changed, runner.cmd)
+	}
+}
+
+func TestUnitFileInstallUser(t *testing.T) {
+	root := t.TempDir()
+	unit := UnitFile{Name: "replica.service", Template: "[Service]\nExecStart=/opt/replica\n", User: true}
+	runner := &fakeCmdRunner{stdin: &strings.Builder{}}
+	host := fakeHost{name: "wrk1", cmd: runner, fsys: wrfs.DirFS(root), env: map[string]string{"HOME": "/home/alice"}}
+	changed, err := unit.Install(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || runner.cmd != "systemctl --user daemon-reload" {
+		t.Errorf("Install() = %t and last ran %q, want change and systemctl --user daemon-reload", changed, runner.cmd)
+	}
+
+	// The unit is expected in the user's systemd directory.
+	dir := filepath.Join(root, "home", "alice", ".config", "systemd", "user")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "replica.service"), []byte(runner.stdin.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner = &fakeCmdRunner{stdin: &strings.Builder{}}
+	host.cmd = runner
+	if changed, err = unit.Install(context.Background(), host); err != nil || changed {
+		t.Errorf("Install() of an unchanged user unit = %t, %v, want no change", changed, err)
+	}
+}
+
+func TestUnitFileInvalid(t *testing.T) {
+	host := fakeHost{name: "wrk1", cmd: &fakeCmdRunner{}, fsys: wrfs.DirFS(t.TempDir())}
+	for _, unit := range []UnitFile{
+		{Name: "", Template: "x"},
+		{Name: "../evil.service", Template: "x"},
+		{Name: "a.service", Template: "{{.Missing"},
+		{Name: "a.service", Template: "{{.Missing}}", Data: map[string]any{}},
+		{Name: "a.service", Template: "x", User: true, Become: &Become{}},
+		{Name: "a.service", Template: "x", User: true, Become: &Become{User: "root"}},
+		{Name: "a.service", Template: "x", User: true},
+	} {
+		if _, err := unit.Install(context.Background(), host); err == nil {
+			t.Errorf("Install(%+v) succeeded, want error", unit)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package iago
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultGrace is the default time a [CancelPolicy] waits for a remote command
+// to exit after signalling it, before escalating to SIGKILL.
+var DefaultGrace = 5 * time.Second
+
+// signalNames maps the signals that can be delivered with an SSH signal
+// request (RFC 4254, section 6.9) to their names without the SIG prefix.
+// The remaining signals exist only on some platforms and are resolved by
+// platformSignalName.
+var signalNames = map[os.Signal]string{
+	os.Interrupt: "INT",
+	os.Kill:      "KILL",
+}
+
+// signalName returns the name of sig without the SIG prefix, as used both by
+// SSH signal requests and by kill -s.
+func signalName(sig os.Signal) (string, error) {
+	if name, ok := signalNames[sig]; ok {
+		return name, nil
+	}
+	if name, ok := platformSignalName(sig); ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("iago: signal %v cannot be sent to a remote process", sig)
+}
+
+// CancelPolicy terminates a remote command gracefully when the context of a
+// [Shell] or [Command] is done. Without a policy, the SSH session is closed,
+// which in many server configurations leaves the remote process running,
+// orphaned under sshd.
+//
+// The policy first sends Signal, then waits up to Grace for the command to
+// exit before sending SIGKILL, and finally closes the session if the command
+// still has not exited after another Grace period. Signals are delivered with
+// SSH signal requests, which OpenSSH supports from version 7.9 and silently
+// ignores before that. Set TrackPID to also deliver them with kill(1) from a
+// separate session, to the process group of the command.
+type CancelPolicy struct {
+	// Signal is the first signal sent; nil means SIGTERM.
+	Signal os.Signal
+	// Grace is the time to wait for the command to exit after each signal;
+	// zero means [DefaultGrace].
+	Grace time.Duration
+	// TrackPID records the process ID of the remote command when it starts,
+	// so that signals can be delivered with kill(1) as well.
+	TrackPID bool
+}
+
+func (p CancelPolicy) signal() os.Signal {
+	if p.Signal == nil {
+		return syscall.SIGTERM
+	}
+	return p.Signal
+}
+
+func (p CancelPolicy) grace() time.Duration {
+	if p.Grace <= 0 {
+		return DefaultGrace
+	}
+	return p.Grace
+}
+
+// trackPID wraps cmd so that the process ID of the shell running it is
+// printed on the first line of its standard output, before the shell replaces
+// itself with cmd. sshd starts each command in a new session, so the process
+// ID is also the ID of the process group of cmd and anything it spawns.
+func trackPID(cmd string) string {
+	return `printf '%d\n' "$$" && exec sh -c ` + Quote(cmd)
+}
+
+// pipePID reads the process ID line written by a command wrapped by
+// [trackPID] from src, sends it on pids, and copies the rest of src to dst.
+func pipePID(dst io.Writer, src io.Reader, pids chan<- int, errChan chan error) {
+	r := bufio.NewReader(src)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		// The command exited before the process ID line was complete.
+		if err == io.EOF {
+			err = nil
+		}
+		errChan <- err
+		return
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+		pids <- pid
+	}
+	_, err = io.Copy(dst, r)
+	errChan <- err
+}
+
+// runCancelable runs sa.Command on cmd like [CmdRunner.RunContext], but when
+// ctx is done it terminates the command according to sa.Cancel. The remote
+// process ID, if tracked, is received on pids.
+func (sa Shell) runCancelable(ctx context.Context, host Host, cmd CmdRunner, pids <-chan int) error {
+	if err := cmd.Start(sa.Command); err != nil {
+		return err
+	}
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	select {
+	case err := <-waitErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	grace := sa.Cancel.grace()
+	pid := 0
+	for _, sig := range []os.Signal{sa.Cancel.signal(), syscall.SIGKILL} {
+		if pid == 0 {
+			select {
+			case pid = <-pids:
+			default:
+			}
+		}
+		sa.deliver(ctx, host, cmd, sig, pid, grace)
+		select {
+		case err := <-waitErr:
+			// The command exited on the signal; its exit status tells how.
+			return err
+		case <-time.After(grace):
+		}
+	}
+	closeCmd(cmd)
+	return ctx.Err()
+}
+
+// deliver sends sig to the remote command with an SSH signal request and, if
+// its process ID is known, with kill(1) from a new session as well. Errors are
+// ignored, since the command may already have exited.
+func (sa Shell) deliver(ctx context.Context, host Host, cmd CmdRunner, sig os.Signal, pid int, timeout time.Duration) {
+	_ = cmd.Signal(sig)
+	if pid <= 0 {
+		return
+	}
+	name, err := signalName(sig)
+	if err != nil {
+		return
+	}
+	killCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	kill := fmt.Sprintf("kill -s %s -- -%d 2>/dev/null || kill -s %s %d", name, pid, name, pid)
+	_ = Shell{Command: kill, Become: sa.Become}.Apply(killCtx, host)
+}
@@ -0,0 +1,182 @@
+package iago
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeSignalRunner is a fakeCmdRunner whose command runs until it receives the
+// signal named dieOn, and then exits as if terminated by it.
+type fakeSignalRunner struct {
+	fakeCmdRunner
+	dieOn string
+
+	mu      sync.Mutex
+	signals []string
+	exited  chan struct{}
+	once    sync.Once
+}
+
+func newFakeSignalRunner(dieOn, output string) *fakeSignalRunner {
+	return &fakeSignalRunner{
+		fakeCmdRunner: fakeCmdRunner{output: output},
+		dieOn:         dieOn,
+		exited:        make(chan struct{}),
+	}
+}
+
+func (r *fakeSignalRunner) Start(cmd string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cmd = cmd
+	return nil
+}
+
+func (r *fakeSignalRunner) Wait() error {
+	<-r.exited
+	return fakeExitError{status: 128, signal: r.dieOn}
+}
+
+func (r *fakeSignalRunner) Signal(sig os.Signal) error {
+	name, err := signalName(sig)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.signals = append(r.signals, name)
+	r.mu.Unlock()
+	if name == r.dieOn {
+		r.once.Do(func() { close(r.exited) })
+	}
+	return nil
+}
+
+func (r *fakeSignalRunner) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.signals...)
+}
+
+// killHost hands out main for the first command and records the commands of
+// every later one, such as the kill(1) fallback of a CancelPolicy.
+type killHost struct {
+	fakeHost
+	main CmdRunner
+
+	mu    sync.Mutex
+	used  bool
+	kills []*fakeCmdRunner
+}
+
+func (h *killHost) NewCommand() (CmdRunner, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.used {
+		h.used = true
+		return h.main, nil
+	}
+	r := &fakeCmdRunner{}
+	h.kills = append(h.kills, r)
+	return r, nil
+}
+
+func (h *killHost) killCommands() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cmds []string
+	for _, r := range h.kills {
+		cmds = append(cmds, r.cmd)
+	}
+	return cmds
+}
+
+func TestCancelPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		dieOn       string
+		wantSignals []string
+	}{
+		{name: "exits on TERM", dieOn: "TERM", wantSignals: []string{"TERM"}},
+		{name: "ignores TERM", dieOn: "KILL", wantSignals: []string{"TERM", "KILL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := newFakeSignalRunner(tt.dieOn, "")
+			host := fakeHost{name: "h", cmd: runner}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err := Shell{Command: "sleep 100", Cancel: &CancelPolicy{Grace: 50 * time.Millisecond}}.Apply(ctx, host)
+			exitErr, ok := errors.AsType[ExitStatus](err)
+			if !ok {
+				t.Fatalf("Apply error = %v, want an exit status", err)
+			}
+			if sig := exitErr.(exitSignal).Signal(); sig != tt.dieOn {
+				t.Errorf("exit signal = %q, want %q", sig, tt.dieOn)
+			}
+			if got := runner.received(); strings.Join(got, ",") != strings.Join(tt.wantSignals, ",") {
+				t.Errorf("signals = %v, want %v", got, tt.wantSignals)
+			}
+		})
+	}
+}
+
+func TestCancelPolicyTrackPID(t *testing.T) {
+	runner := newFakeSignalRunner("TERM", "4242\nhello\n")
+	host := &killHost{fakeHost: fakeHost{name: "h"}, main: runner}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var out strings.Builder
+	policy := &CancelPolicy{Signal: syscall.SIGINT, Grace: 50 * time.Millisecond, TrackPID: true}
+	runner.dieOn = "INT"
+	err := Shell{Command: "sleep 100", Stdout: &out, Cancel: policy}.Apply(ctx, host)
+	if _, ok := errors.AsType[ExitStatus](err); !ok {
+		t.Fatalf("Apply error = %v, want an exit status", err)
+	}
+	if want := `printf '%d\n' "$$" && exec sh -c 'sleep 100'`; runner.cmd != want {
+		t.Errorf("command = %q, want %q", runner.cmd, want)
+	}
+	if got := out.String(); got != "hello\n" {
+		t.Errorf("stdout = %q, want the output without the process ID line", got)
+	}
+	kills := host.killCommands()
+	if len(kills) != 1 || kills[0] != "kill -s INT -- -4242 2>/dev/null || kill -s INT 4242" {
+		t.Errorf("kill commands = %q, want one kill -s INT of process 4242", kills)
+	}
+}
+
+// testSignal is a signal that cannot be delivered to a remote process.
+type testSignal struct{}
+
+func (testSignal) String() string { return "test" }
+func (testSignal) Signal()        {}
+
+func TestSignalName(t *testing.T) {
+	tests := []struct {
+		sig  os.Signal
+		want string
+	}{
+		{os.Interrupt, "INT"},
+		{os.Kill, "KILL"},
+	}
+	// On Plan 9, SIGTERM is the interrupt note.
+	if syscall.SIGTERM != os.Interrupt {
+		tests = append(tests, struct {
+			sig  os.Signal
+			want string
+		}{syscall.SIGTERM, "TERM"})
+	}
+	for _, tt := range tests {
+		if got, err := signalName(tt.sig); err != nil || got != tt.want {
+			t.Errorf("signalName(%v) = %q, %v, want %q", tt.sig, got, err, tt.want)
+		}
+	}
+	if _, err := signalName(testSignal{}); err == nil {
+		t.Error("signalName(test): got nil error")
+	}
+}
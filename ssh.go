@@ -21,16 +21,18 @@ import (
 )
 
 type sshHost struct {
+	Vars
 	name          string
 	env           map[string]string
 	client        *ssh.Client
 	sftpClient    *sftp.Client
 	fsys          fs.FS
-	vars          map[string]any
 	forwardAgent  bool
-	agentConn     net.Conn  // non-nil when agent forwarding is active; closed by Close
-	stopKeepAlive func()    // non-nil when keepalives are running; stops them on Close
-	agentFwdOnce  sync.Once // sends auth-agent-req on the first session only (see requestAgentForwarding)
+	agentConn     net.Conn      // non-nil when agent forwarding is active; closed by Close
+	stopKeepAlive func()        // non-nil when keepalives are running; stops them on Close
+	agentFwdOnce  sync.Once     // sends auth-agent-req on the first session only (see requestAgentForwarding)
+	done          chan struct{} // closed when the connection is closed or lost
+	forwards      forwardSet    // port forwards, closed by Close
 }
 
 // DialSSH connects to a remote host using ssh.
@@ -42,26 +44,68 @@ func DialSSH(name, addr string, cfg *ssh.ClientConfig) (Host, error) {
 	return newHostFromClient(name, client, false, 0)
 }
 
-// dialViaProxy connects to a remote host by tunnelling through an already-established
-// SSH connection to a jump host. The jump client is not owned by the returned Host;
-// its lifetime is managed by the caller (typically [NewSSHGroup], which shares one
-// jump client across all targets that route through the same ProxyJump spec).
-func dialViaProxy(name, addr string, cfg *ssh.ClientConfig, jump *ssh.Client, forwardAgent bool, keepAlive time.Duration) (Host, error) {
+// DialSSHProxy is like [DialSSH], but connects through the SOCKS5 or HTTP
+// CONNECT proxy at proxyURL, which has the form described by [Proxy].
+func DialSSHProxy(name, addr string, cfg *ssh.ClientConfig, proxyURL string) (Host, error) {
+	proxy, err := parseProxyURL(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dialSSHProxy(proxy, addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newHostFromClient(name, client, false, 0)
+}
+
+// dialClient establishes an SSH connection to addr, directly if via is nil and
+// otherwise tunnelled through via. Tunnelled dials honor cfg.Timeout.
+func dialClient(addr string, cfg *ssh.ClientConfig, via *ssh.Client) (*ssh.Client, error) {
+	if via == nil {
+		return ssh.Dial("tcp", addr, cfg)
+	}
 	ctx := context.Background()
 	if cfg.Timeout > 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
 		defer cancel()
 	}
-	conn, err := jump.DialContext(ctx, "tcp", addr)
+	conn, err := via.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return nil, err
 	}
 	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
 	if err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
-	return newHostFromClient(name, ssh.NewClient(ncc, chans, reqs), forwardAgent, keepAlive)
+	return ssh.NewClient(ncc, chans, reqs), nil
+}
+
+// dial establishes an SSH connection to alias with cfg. When via is nil, the
+// connection runs over the alias's ProxyCommand if it has one and is otherwise
+// dialed directly or through its proxy (see [Proxy]); when via is non-nil it
+// is tunnelled through via, and any ProxyCommand is ignored, as for a later
+// host of a ProxyJump list.
+func (cw *sshConfig) dial(alias string, cfg *ssh.ClientConfig, via *ssh.Client) (*ssh.Client, error) {
+	addr := cw.ConnectAddr(alias)
+	if via == nil {
+		command, err := cw.proxyCommand(alias, cfg.User)
+		if err != nil {
+			return nil, err
+		}
+		if command != "" {
+			return dialProxyCommand(command, addr, cfg)
+		}
+		proxy, err := cw.proxyURL(alias)
+		if err != nil {
+			return nil, err
+		}
+		if proxy != nil {
+			return dialSSHProxy(proxy, addr, cfg)
+		}
+	}
+	return dialClient(addr, cfg, via)
 }
 
 // newHostFromClient wraps an established *ssh.Client as a Host, creating the SFTP
@@ -110,10 +154,14 @@ func newHostFromClient(name string, client *ssh.Client, forwardAgent bool, keepA
 		client:       client,
 		sftpClient:   sftpClient,
 		fsys:         sftpfs.New(sftpClient, "/"),
-		vars:         make(map[string]any),
 		forwardAgent: forwardAgent,
 		agentConn:    agentConn,
+		done:         make(chan struct{}),
 	}
+	go func() {
+		_ = client.Wait()
+		close(host.done)
+	}()
 	if keepAlive > 0 {
 		// On a dead connection the keepalive fails; close the client so any
 		// session blocked on a read returns instead of hanging indefinitely.
@@ -192,11 +240,18 @@ func keepAliveLoop(client keepAlivePinger, tick <-chan time.Time, onDead func(),
 // avoids opening one proxy connection per target alias. The shared jump clients are
 // owned by the returned [Group] and closed by [Group.Close].
 //
+// ProxyJump may list several comma-separated jump hosts, and a jump host may
+// itself have a ProxyJump; each hop of such a chain is dialed through the one
+// before it and shared by every target routed through the same hops. A
+// ProxyJump of "none" disables jumping, and a chain that leads back to one of
+// its own hosts fails with [ErrJumpCycle]. An alias with a ProxyCommand is
+// reached over the standard input and output of that command instead.
+//
 // By default, dial failures are collected in [Group.DialErrors] instead of
 // aborting the call. If no hosts connect successfully, an error is returned.
 // Pass [FailFast] to return an error if any target fails. Pass [DialConcurrency]
 // to dial target hosts concurrently; jump connections are always established
-// sequentially first so at most one TCP connection is made to each jump host.
+// sequentially first so at most one connection is made to each hop.
 func NewSSHGroup(hostAliases []string, sshConfigFile string, opts ...GroupOption) (group Group, err error) {
 	cfg := applyGroupOptions(opts...)
 	sshConfigFile, err = resolveSSHConfigFile(sshConfigFile)
@@ -207,6 +262,16 @@ func NewSSHGroup(hostAliases []string, sshConfigFile string, opts ...GroupOption
 	if err != nil {
 		return group, err
 	}
+	if cfg.proxy != "" {
+		if _, err = parseProxyURL(cfg.proxy); err != nil {
+			return group, err
+		}
+		config.proxy = cfg.proxy
+	}
+	config.password = cfg.password
+	config.keyboardInteractive = cfg.keyboardInteractive
+	config.passphrase = cfg.passphrase
+	config.errorHandler = cfg.errorHandler
 
 	dialer := newGroupDialer(config, hostAliases, cfg)
 	defer dialer.closeOnError(&err)
@@ -221,7 +286,7 @@ func NewSSHGroup(hostAliases []string, sshConfigFile string, opts ...GroupOption
 }
 
 // groupDialer assembles a [Group] by dialing a set of host aliases under a single
-// SSH config, sharing one connection per distinct ProxyJump spec.
+// SSH config, sharing one connection per distinct ProxyJump hop.
 //
 // Its lifecycle has two phases separated by a deliberate concurrency boundary:
 //
@@ -238,71 +303,91 @@ type groupDialer struct {
 	config      *sshConfig
 	aliases     []string
 	cfg         groupConfig
-	jumpClients map[string]*ssh.Client // proxy spec -> shared jump connection
-	jumpErrs    map[string]error       // proxy spec -> error establishing it
+	jumpClients map[string]*ssh.Client // jump key -> shared jump connection
+	jumpErrs    map[string]error       // jump key -> error establishing it
+	jumps       *jumpPool              // jumpClients, shared by hosts that reconnect
 	hosts       []Host                 // successfully dialed targets
 	dialErrs    map[string]error       // alias -> dial error; nil until first failure
 }
 
 func newGroupDialer(config *sshConfig, aliases []string, cfg groupConfig) *groupDialer {
+	jumpClients := make(map[string]*ssh.Client)
 	return &groupDialer{
 		config:      config,
 		aliases:     aliases,
 		cfg:         cfg,
-		jumpClients: make(map[string]*ssh.Client),
+		jumpClients: jumpClients,
 		jumpErrs:    make(map[string]error),
+		jumps:       &jumpPool{config: config, clients: jumpClients},
 	}
 }
 
-// prepareJumps establishes one shared connection per distinct ProxyJump spec
-// referenced by the aliases. With [FailFast] set, the first failure is returned
-// immediately; otherwise failures are recorded per spec and later surfaced as
-// the dial error of every alias routing through that jump (see [groupDialer.jumpFor]).
+// prepareJumps establishes one shared connection per distinct hop of the
+// ProxyJump chains referenced by the aliases, dialing each hop through the one
+// before it. A hop is keyed by its route (see [jumpKey]), so targets whose
+// chains share a prefix share the connections along it. With [FailFast] set,
+// the first failure is returned immediately; otherwise failures are recorded
+// per hop and later surfaced as the dial error of every alias routing through
+// that hop (see [groupDialer.jumpFor]).
 func (d *groupDialer) prepareJumps(cfg groupConfig) error {
 	for _, alias := range d.aliases {
-		proxySpec, err := d.config.get(alias, "ProxyJump")
-		if err != nil || proxySpec == "" || proxySpec == "none" {
-			continue
-		}
-		if _, ok := d.jumpClients[proxySpec]; ok {
-			continue
-		}
-		if _, ok := d.jumpErrs[proxySpec]; ok {
-			continue
-		}
-		client, err := dialJump(proxySpec, d.config)
+		chain, err := d.config.jumpChain(alias)
 		if err != nil {
 			if cfg.failFast {
 				return err
 			}
-			d.jumpErrs[proxySpec] = err
+			// jumpFor resolves the chain again and reports the error.
 			continue
 		}
-		d.jumpClients[proxySpec] = client
+		var via *ssh.Client
+		for i, hop := range chain {
+			key := jumpKey(chain, i)
+			if client, ok := d.jumpClients[key]; ok {
+				via = client
+				continue
+			}
+			if _, ok := d.jumpErrs[key]; ok {
+				break
+			}
+			client, err := dialJump(hop, d.config, via)
+			if err != nil {
+				if cfg.failFast {
+					return err
+				}
+				d.jumpErrs[key] = err
+				break
+			}
+			d.jumpClients[key] = client
+			via = client
+		}
 	}
 	return nil
 }
 
 // jumpFor resolves the shared jump connection for alias. It returns (nil, nil)
 // when alias connects directly, (client, nil) when it routes through an
-// established jump, or (nil, err) when its jump could not be established. It only
-// reads state populated by prepareJumps, so it is safe for concurrent callers.
+// established chain, or (nil, err) when its chain could not be resolved or
+// established. It only reads state populated by prepareJumps, so it is safe
+// for concurrent callers.
 func (d *groupDialer) jumpFor(alias string) (*ssh.Client, error) {
-	proxySpec, err := d.config.get(alias, "ProxyJump")
+	chain, err := d.config.jumpChain(alias)
 	if err != nil {
 		return nil, err
 	}
-	if proxySpec == "" || proxySpec == "none" {
+	if len(chain) == 0 {
 		return nil, nil
 	}
-	if err := d.jumpErrs[proxySpec]; err != nil {
-		return nil, err
+	for i := range chain {
+		if err := d.jumpErrs[jumpKey(chain, i)]; err != nil {
+			return nil, err
+		}
 	}
-	client := d.jumpClients[proxySpec]
+	key := jumpKey(chain, len(chain)-1)
+	client := d.jumpClients[key]
 	if client == nil {
-		// prepareJumps establishes every referenced spec, so a missing client
+		// prepareJumps establishes every referenced hop, so a missing client
 		// signals a programming error rather than a connection failure.
-		return nil, fmt.Errorf("iago: proxy jump %q was not prepared", proxySpec)
+		return nil, fmt.Errorf("iago: proxy jump %q was not prepared", key)
 	}
 	return client, nil
 }
@@ -366,7 +451,53 @@ func (d *groupDialer) dialOne(alias string) sshDialResult {
 		return sshDialResult{err: err}
 	}
 	host, err := dialTarget(alias, d.config, jump, d.cfg.forwardAgent, d.cfg.keepAliveInterval)
-	return sshDialResult{host: host, err: err}
+	if err != nil {
+		return sshDialResult{err: err}
+	}
+	if d.cfg.reconnect != nil {
+		host = newReconnectingHost(host.(connHost), *d.cfg.reconnect, func() (connHost, error) {
+			return d.redial(alias)
+		})
+	}
+	if err := d.seedVars(alias, host); err != nil {
+		_ = host.Close()
+		return sshDialResult{err: err}
+	}
+	return sshDialResult{host: host}
+}
+
+// redial dials alias again for a host that lost its connection, through a
+// live connection to the last hop of its ProxyJump chain, if any, from the shared jump pool.
+func (d *groupDialer) redial(alias string) (connHost, error) {
+	chain, err := d.config.jumpChain(alias)
+	if err != nil {
+		return nil, err
+	}
+	var jump *ssh.Client
+	if len(chain) > 0 {
+		if jump, err = d.jumps.client(chain); err != nil {
+			return nil, err
+		}
+	}
+	host, err := dialTarget(alias, d.config, jump, d.cfg.forwardAgent, d.cfg.keepAliveInterval)
+	if err != nil {
+		return nil, err
+	}
+	return host.(connHost), nil
+}
+
+// seedVars sets the variables of alias from the SSH config, then from an
+// [Inventory] and finally from [HostVars], so that later sources take
+// precedence.
+func (d *groupDialer) seedVars(alias string, host Host) error {
+	vars, err := d.config.configVars(alias)
+	if err != nil {
+		return err
+	}
+	seedVars(host, vars)
+	seedVars(host, d.cfg.inventoryVars[alias])
+	seedVars(host, d.cfg.hostVars[alias])
+	return nil
 }
 
 // collect records per-alias results in aliases order, lazily allocating dialErrs
@@ -418,11 +549,14 @@ func (d *groupDialer) allFailedError() error {
 func (d *groupDialer) group() Group {
 	group := NewGroup(d.hosts)
 	group.DialErrors = d.dialErrs
+	group.failures = d.cfg.failurePolicy
 	if d.cfg.errorHandler != nil {
 		group.ErrorHandler = d.cfg.errorHandler
 	}
-	for _, jc := range d.jumpClients {
-		group.sharedClosers = append(group.sharedClosers, jc)
+	// The pool is registered even if it is empty, since hosts that reconnect
+	// may dial jump hosts into it later.
+	if d.jumps != nil {
+		group.sharedClosers = append(group.sharedClosers, d.jumps)
 	}
 	return group
 }
@@ -436,9 +570,7 @@ func (d *groupDialer) closeOnError(errPtr *error) {
 	for _, h := range d.hosts {
 		_ = h.Close()
 	}
-	for _, jc := range d.jumpClients {
-		_ = jc.Close()
-	}
+	_ = d.jumps.Close()
 }
 
 type sshDialResult struct {
@@ -453,27 +585,14 @@ func dialConcurrency(concurrency, aliases int) int {
 	return min(concurrency, aliases)
 }
 
-// dialJump establishes a new SSH connection to the given ProxyJump spec. The
-// returned client is a bare [ssh.Client] used only as a tunnel; unlike a target
-// host it has no SFTP sub-client or fetched environment.
-func dialJump(proxySpec string, config *sshConfig) (*ssh.Client, error) {
-	jumpCfg, err := config.ClientConfig(proxySpec)
-	if err != nil {
-		return nil, fmt.Errorf("proxy jump %q: %w", proxySpec, err)
-	}
-	client, err := ssh.Dial("tcp", config.ConnectAddr(proxySpec), jumpCfg)
-	if err != nil {
-		return nil, fmt.Errorf("dial proxy jump %q: %w", proxySpec, err)
-	}
-	return client, nil
-}
-
 // dialTarget dials a single target alias. When jump is non-nil the connection is
-// tunnelled through that shared jump client; otherwise it is dialed directly. The
+// tunnelled through that shared jump client; otherwise it is dialed directly, or
+// through the alias's ProxyCommand if it has one. The
 // jump client's lifetime is managed by the caller, not by the returned Host.
 // forceForwardAgent forces agent forwarding regardless of the SSH config value;
 // it is set when [ForwardAgent] was passed as a [GroupOption] to [NewSSHGroup].
 // keepAlive, when positive, starts periodic SSH keepalives on the connection.
+// The port forwards configured for the alias are started on the new host.
 func dialTarget(alias string, config *sshConfig, jump *ssh.Client, forceForwardAgent bool, keepAlive time.Duration) (Host, error) {
 	clientCfg, err := config.ClientConfig(alias)
 	if err != nil {
@@ -484,15 +603,19 @@ func dialTarget(alias string, config *sshConfig, jump *ssh.Client, forceForwardA
 		return nil, err
 	}
 	forwardAgent := forceForwardAgent || configForwardAgent
-	addr := config.ConnectAddr(alias)
-	if jump == nil {
-		client, err := ssh.Dial("tcp", addr, clientCfg)
-		if err != nil {
-			return nil, err
-		}
-		return newHostFromClient(alias, client, forwardAgent, keepAlive)
+	client, err := config.dial(alias, clientCfg, jump)
+	if err != nil {
+		return nil, err
+	}
+	host, err := newHostFromClient(alias, client, forwardAgent, keepAlive)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.startForwards(alias, host); err != nil {
+		_ = host.Close()
+		return nil, err
 	}
-	return dialViaProxy(alias, addr, clientCfg, jump, forwardAgent, keepAlive)
+	return host, nil
 }
 
 // fetchEnv returns a map containing the environment variables of the ssh server.
@@ -613,20 +736,41 @@ func (h *sshHost) Close() error {
 	if h.stopKeepAlive != nil {
 		h.stopKeepAlive()
 	}
+	forwardErr := h.forwards.close()
 	var agentErr error
 	if h.agentConn != nil {
 		agentErr = h.agentConn.Close()
 	}
-	return errors.Join(h.sftpClient.Close(), h.client.Close(), agentErr)
+	return errors.Join(forwardErr, h.sftpClient.Close(), h.client.Close(), agentErr)
+}
+
+// DialContext connects to addr on network from the remote host; see [Dialer].
+func (h *sshHost) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return h.client.DialContext(ctx, network, addr)
 }
 
-func (h *sshHost) SetVar(key string, val any) {
-	h.vars[key] = val
+func (h *sshHost) listenRemote(addr string) (net.Listener, error) {
+	return h.client.Listen("tcp", addr)
 }
 
-func (h *sshHost) GetVar(key string) (val any, ok bool) {
-	val, ok = h.vars[key]
-	return
+func (h *sshHost) forwardSet() *forwardSet {
+	return &h.forwards
+}
+
+// connected reports whether the connection to the host is still up. With
+// probe set, a connection that has not been observed to close is checked with
+// a keepalive request.
+func (h *sshHost) connected(probe bool) bool {
+	select {
+	case <-h.done:
+		return false
+	default:
+	}
+	if !probe {
+		return true
+	}
+	_, _, err := h.client.SendRequest(keepAliveRequest, true, nil)
+	return err == nil
 }
 
 type sshCmd struct {
@@ -669,6 +813,42 @@ func (c sshCmd) Wait() (err error) {
 	return c.session.Wait()
 }
 
+// Setenv sets an environment variable of the command before it starts. It
+// fails if the server does not accept the variable; see the AcceptEnv option
+// of sshd_config.
+func (c sshCmd) Setenv(name, value string) error {
+	return c.session.Setenv(name, value)
+}
+
+// Signal sends sig to the remote process with an SSH signal request.
+func (c sshCmd) Signal(sig os.Signal) error {
+	name, err := signalName(sig)
+	if err != nil {
+		return err
+	}
+	return c.session.Signal(ssh.Signal(name))
+}
+
+// RequestPty allocates a pseudo-terminal for the command.
+func (c sshCmd) RequestPty(pty PTY) error {
+	return c.session.RequestPty(pty.Term, pty.Height, pty.Width, ssh.TerminalModes(pty.Modes))
+}
+
+// WindowChange informs the remote terminal that its size has changed.
+func (c sshCmd) WindowChange(size WindowSize) error {
+	return c.session.WindowChange(size.Height, size.Width)
+}
+
+// StartShell starts the user's login shell.
+func (c sshCmd) StartShell() error {
+	return c.session.Shell()
+}
+
+// Close closes the session, which terminates the command if it is running.
+func (c sshCmd) Close() error {
+	return c.session.Close()
+}
+
 func (c sshCmd) StdinPipe() (io.WriteCloser, error) {
 	return c.session.StdinPipe()
 }
@@ -12,6 +12,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -63,7 +64,7 @@ func ParseSSHConfig(configFile string) (*sshConfig, error) {
 	if err != nil {
 		return nil, fmt.Errorf("iago: failed to decode ssh config file: %w", err)
 	}
-	return &sshConfig{decodedConfig}, nil
+	return &sshConfig{config: decodedConfig}, nil
 }
 
 // resolveSSHConfigFile returns the path to the SSH config file to use, based
@@ -82,7 +83,37 @@ func resolveSSHConfigFile(sshConfigFile string) (string, error) {
 }
 
 type sshConfig struct {
-	config *ssh_config.Config
+	config              *ssh_config.Config
+	proxy               string                      // proxy URL for hosts without IagoProxy; see [Proxy]
+	password            PasswordCallback            // see [PasswordAuth]
+	keyboardInteractive KeyboardInteractiveCallback // see [KeyboardInteractiveAuth]
+	passphrase          PassphraseCallback          // see [Passphrase]
+	keys                keyCache                    // private keys of IdentityFiles
+	errorHandler        ErrorHandler                // see [sshConfig.warn]
+
+	mu     sync.Mutex
+	warned map[string]bool // problems already reported by warn
+}
+
+// warn reports a problem that does not fail a dial, such as an unusable key
+// or a port forward that failed to start, to the ErrorHandler given with
+// [WithErrorHandler], unless the same problem was reported before. Without an
+// ErrorHandler, the problem is ignored.
+func (cw *sshConfig) warn(err error) {
+	if cw.errorHandler == nil {
+		return
+	}
+	cw.mu.Lock()
+	if cw.warned[err.Error()] {
+		cw.mu.Unlock()
+		return
+	}
+	if cw.warned == nil {
+		cw.warned = make(map[string]bool)
+	}
+	cw.warned[err.Error()] = true
+	cw.mu.Unlock()
+	cw.errorHandler(err)
 }
 
 // ClientConfig returns a [ssh.ClientConfig] for the given host alias.
@@ -97,22 +128,6 @@ func (cw *sshConfig) ClientConfig(hostAlias string) (*ssh.ClientConfig, error) {
 		return nil, err
 	}
 
-	signers := agentSigners()
-	identityFile, err := cw.get(hostAlias, "IdentityFile")
-	if err != nil {
-		return nil, err
-	}
-	pubkey := fileSigner(identityFile)
-	if pubkey != nil {
-		signers = append(signers, pubkey)
-	}
-	if len(signers) == 0 {
-		// Cannot authenticate without any signers in ssh agent or the provided identity file.
-		// If the identity file contains a passphrase protected private key, this will fail
-		// as the passphrase cannot be provided here.
-		return nil, fmt.Errorf("iago: no valid authentication methods found for %s", hostAlias)
-	}
-
 	username, err := cw.get(hostAlias, "User")
 	if err != nil {
 		return nil, err
@@ -126,10 +141,15 @@ func (cw *sshConfig) ClientConfig(hostAlias string) (*ssh.ClientConfig, error) {
 		username = currentUser.Username
 	}
 
+	auth, err := cw.authMethods(hostAlias, username)
+	if err != nil {
+		return nil, err
+	}
+
 	clientConfig := &ssh.ClientConfig{
 		Config:            ssh.Config{},
 		User:              username,
-		Auth:              []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		Auth:              auth,
 		HostKeyCallback:   hostKeyCallback,
 		HostKeyAlgorithms: cw.knownHostAlgorithms(hostAlias),
 		Timeout:           timeout,
@@ -205,20 +225,6 @@ func (cw *sshConfig) get(alias, key string) (string, error) {
 	return val, nil
 }
 
-// fileSigner returns a SSH signer based on the private key in the specified IdentityFile.
-// If the file cannot be read, parsed, or if the private key is passphrase protected, it returns nil.
-func fileSigner(file string) ssh.Signer {
-	buffer, err := os.ReadFile(expand(file))
-	if err != nil {
-		return nil
-	}
-	key, err := ssh.ParsePrivateKey(buffer)
-	if err != nil {
-		return nil
-	}
-	return key
-}
-
 // agentSigners returns a list of SSH signers obtained from the SSH agent.
 // It returns nil if there are no signers available or if there is an error connecting to the agent.
 func agentSigners() []ssh.Signer {
@@ -265,12 +271,12 @@ func (cw *sshConfig) getHostKeyCallback(hostAlias string) (hostKeyCallback ssh.H
 // ED25519), which causes "knownhosts: key mismatch" when the server offers
 // multiple key types but only one of them is stored locally.
 //
+// When a @cert-authority entry matches the host, the host certificate
+// algorithms come first, so that a host presenting a certificate signed by
+// the authority is verified by it. @revoked entries are skipped.
+//
 // Returns nil when strict host key checking is disabled or no matching entries
 // are found; in those cases the caller must not constrain HostKeyAlgorithms.
-//
-// Note: entries with OpenSSH glob wildcard patterns (e.g. *.example.com) or
-// negation prefixes (e.g. !host) in the hostname field are not matched; only
-// exact hostname matches are supported.
 func (cw *sshConfig) knownHostAlgorithms(hostAlias string) []string {
 	strictHostKeyChecking, err := cw.get(hostAlias, "StrictHostKeyChecking")
 	if err != nil || strictHostKeyChecking == "no" {
@@ -287,6 +293,7 @@ func (cw *sshConfig) knownHostAlgorithms(hostAlias string) []string {
 	norm := knownhosts.Normalize(addr)
 
 	var algos []string
+	var certAuthority bool
 	seen := make(map[string]bool)
 	for file := range strings.SplitSeq(userKnownHostsFile, " ") {
 		file = expand(file)
@@ -296,37 +303,45 @@ func (cw *sshConfig) knownHostAlgorithms(hostAlias string) []string {
 		}
 		for line := range strings.Lines(string(data)) {
 			line = strings.TrimSpace(line)
-			// Skip comments, blank lines, and markers.
-			if line == "" || line[0] == '#' || line[0] == '@' {
+			// Skip comments and blank lines.
+			if line == "" || line[0] == '#' {
 				continue
 			}
 			fields := strings.Fields(line)
+			var marker string
+			if strings.HasPrefix(fields[0], "@") {
+				marker, fields = fields[0], fields[1:]
+			}
 			if len(fields) < 3 {
 				continue
 			}
 			// fields[0] is a comma-separated list of hostname patterns or a
 			// single hashed entry in the |1|salt|hash format.
 			// fields[1] is the key type (e.g. "ssh-ed25519").
-			for h := range strings.SplitSeq(fields[0], ",") {
-				var matches bool
-				if strings.HasPrefix(h, "|1|") {
-					matches = matchesHashedHost(h, norm)
-				} else {
-					matches = h == norm
-				}
-				if matches && !seen[fields[1]] {
+			if !matchKnownHost(fields[0], norm) {
+				continue
+			}
+			switch marker {
+			case "":
+				if !seen[fields[1]] {
 					algos = append(algos, fields[1])
 					seen[fields[1]] = true
-					break
 				}
+			case markerCertAuthority:
+				certAuthority = true
 			}
 		}
 	}
+	if certAuthority {
+		algos = append(slices.Clone(hostCertAlgorithms), algos...)
+	}
 	return algos
 }
 
 // createHostKeyCallback returns a HostKeyCallback that checks the host keys against the known hosts files.
 // It skips files that do not exist and returns an error if no valid known hosts files are provided.
+// Host certificates are accepted if signed by a matching @cert-authority, and keys marked @revoked
+// are rejected, including when they certify or sign a host certificate.
 func createHostKeyCallback(userKnownHostsFilesPaths []string) (ssh.HostKeyCallback, error) {
 	var userKnownHostsFiles []string
 	for _, file := range userKnownHostsFilesPaths {
@@ -336,7 +351,17 @@ func createHostKeyCallback(userKnownHostsFilesPaths []string) (ssh.HostKeyCallba
 		}
 		userKnownHostsFiles = append(userKnownHostsFiles, file)
 	}
-	return knownhosts.New(userKnownHostsFiles...)
+	callback, err := knownhosts.New(userKnownHostsFiles...)
+	if err != nil {
+		return nil, err
+	}
+	revoked := revokedKeys(userKnownHostsFiles)
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := checkRevoked(revoked, key); err != nil {
+			return err
+		}
+		return callback(hostname, remote, key)
+	}, nil
 }
 
 // matchesHashedHost reports whether host matches the hashed known_hosts pattern.
@@ -497,3 +522,32 @@ func (cw *sshConfig) hostAliases(pattern string) ([]string, error) {
 	}
 	return hosts, nil
 }
+
+// iagoVarKeyword is the ssh_config(5) keyword used to seed host variables, as
+// in "IagoVar replicas=3". OpenSSH rejects unknown keywords, so configuration
+// files shared with ssh(1) must also contain "IgnoreUnknown IagoVar".
+const iagoVarKeyword = "IagoVar"
+
+// configVars returns the variables set for alias with IagoVar in the SSH
+// config. Values are strings. Since ssh_config(5) uses the first value
+// obtained for each keyword, a variable set in several matching Host blocks
+// keeps its first value.
+func (cw *sshConfig) configVars(alias string) (map[string]any, error) {
+	values, err := cw.config.GetAll(alias, iagoVarKeyword)
+	if err != nil {
+		return nil, fmt.Errorf("iago: failed to get %s for %s: %w", iagoVarKeyword, alias, err)
+	}
+	vars := make(map[string]any, len(values))
+	for _, value := range values {
+		for field := range strings.FieldsSeq(value) {
+			key, val, ok := strings.Cut(field, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("iago: invalid %s %q for %s: want key=value", iagoVarKeyword, field, alias)
+			}
+			if _, ok := vars[key]; !ok {
+				vars[key] = val
+			}
+		}
+	}
+	return vars, nil
+}
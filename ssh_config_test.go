@@ -2,6 +2,7 @@ package iago
 
 import (
 	"fmt"
+	"maps"
 	"slices"
 	"strconv"
 	"testing"
@@ -137,7 +138,9 @@ func TestProxyJumpConfig(t *testing.T) {
 //   - a single key type for "myhost" at a non-default port (2222), whose
 //     known_hosts entry uses the "[host]:port" format,
 //   - an entry for "other-host" that must never match "myhost" lookups,
-//   - a hashed entry (starting with "|1|") matched via HMAC-SHA1 by matchesHashedHost.
+//   - a hashed entry (starting with "|1|") matched via HMAC-SHA1 by matchesHashedHost,
+//   - a @cert-authority entry for *.example.com except legacy.example.com,
+//   - a @revoked entry for all hosts, which must never contribute algorithms.
 func TestKnownHostAlgorithms(t *testing.T) {
 	config, err := ParseSSHConfig("testdata/config-known-hosts")
 	if err != nil {
@@ -169,6 +172,21 @@ func TestKnownHostAlgorithms(t *testing.T) {
 			hostAlias: "nomatch",
 			wantAlgos: nil,
 		},
+		{
+			name:      "CertAuthorityFirst",
+			hostAlias: "ca-host",
+			wantAlgos: append(slices.Clone(hostCertAlgorithms), "ssh-ed25519"),
+		},
+		{
+			name:      "CertAuthorityOnly",
+			hostAlias: "ca-only",
+			wantAlgos: hostCertAlgorithms,
+		},
+		{
+			name:      "CertAuthorityNegated",
+			hostAlias: "ca-excluded",
+			wantAlgos: []string{"ssh-rsa"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -381,3 +399,31 @@ func TestForwardAgent(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigVars(t *testing.T) {
+	config, err := ParseSSHConfig("testdata/config-vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hostAlias string
+		want      map[string]any
+		wantErr   bool
+	}{
+		{hostAlias: "replica1", want: map[string]any{"role": "replica", "region": "eu", "zone": "a"}},
+		{hostAlias: "other", want: map[string]any{"region": "us"}},
+		{hostAlias: "client", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hostAlias, func(t *testing.T) {
+			got, err := config.configVars(tt.hostAlias)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configVars(%s) error = %v, wantErr %v", tt.hostAlias, err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("configVars(%s) = %v, want %v", tt.hostAlias, got, tt.want)
+			}
+		})
+	}
+}
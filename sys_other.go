@@ -0,0 +1,28 @@
+//go:build !unix
+
+package iago
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// notifyResize is a no-op on platforms without SIGWINCH; the remote terminal
+// keeps the size it was given when the session started.
+func notifyResize(chan<- os.Signal) {}
+
+// platformSignalName names SIGTERM, the default signal of a [CancelPolicy],
+// the only other signal that can be sent from this platform. On Plan 9, SIGTERM
+// is the interrupt note and is named by signalNames instead.
+func platformSignalName(sig os.Signal) (string, bool) {
+	if sig == syscall.SIGTERM {
+		return "TERM", true
+	}
+	return "", false
+}
+
+// openStdin returns standard input. Close does not interrupt a pending Read
+// on this platform, so the copy from standard input in [Interactive] ends
+// only with the next keystroke after the shell exits.
+func openStdin() io.ReadCloser { return io.NopCloser(os.Stdin) }
@@ -0,0 +1,74 @@
+//go:build unix
+
+package iago
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize relays terminal window size changes (SIGWINCH) to c.
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
+
+// platformSignalName returns the name of the Unix-only signals that the SSH
+// protocol defines.
+func platformSignalName(sig os.Signal) (string, bool) {
+	switch sig {
+	case syscall.SIGABRT:
+		return "ABRT", true
+	case syscall.SIGALRM:
+		return "ALRM", true
+	case syscall.SIGFPE:
+		return "FPE", true
+	case syscall.SIGHUP:
+		return "HUP", true
+	case syscall.SIGILL:
+		return "ILL", true
+	case syscall.SIGPIPE:
+		return "PIPE", true
+	case syscall.SIGQUIT:
+		return "QUIT", true
+	case syscall.SIGSEGV:
+		return "SEGV", true
+	case syscall.SIGTERM:
+		return "TERM", true
+	case syscall.SIGUSR1:
+		return "USR1", true
+	case syscall.SIGUSR2:
+		return "USR2", true
+	}
+	return "", false
+}
+
+// openStdin returns a reader of standard input whose Close interrupts a
+// pending Read. It reads from a non-blocking duplicate of the descriptor, so
+// that the read is handled by the runtime poller; if that is not possible, it
+// falls back to reading os.Stdin directly, and Close does not interrupt it.
+func openStdin() io.ReadCloser {
+	fd, err := syscall.Dup(int(os.Stdin.Fd()))
+	if err != nil {
+		return io.NopCloser(os.Stdin)
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		_ = syscall.Close(fd)
+		return io.NopCloser(os.Stdin)
+	}
+	return &stdinReader{File: os.NewFile(uintptr(fd), os.Stdin.Name())}
+}
+
+// stdinReader is a non-blocking duplicate of standard input.
+type stdinReader struct {
+	*os.File
+}
+
+// Close closes the duplicate, interrupting a pending Read, and puts standard
+// input back in blocking mode; the mode is shared by both descriptors.
+func (r *stdinReader) Close() error {
+	err := r.File.Close()
+	return errors.Join(err, syscall.SetNonblock(int(os.Stdin.Fd()), false))
+}
@@ -0,0 +1,287 @@
+package iago
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an in-process SSH server. It runs "env" by printing a fixed
+// environment and "sleep" by waiting for the client to give up, serves SFTP from the local file system, opens direct-tcpip
+// channels by dialing their destination, and serves tcpip-forward requests
+// on the loopback interface, which is enough for [DialSSH], for tunnelling
+// through the server as a jump host and for port forwarding.
+type testServer struct {
+	addr    string
+	hostKey ssh.Signer
+	config  *ssh.ServerConfig
+	ln      net.Listener
+	wg      sync.WaitGroup
+}
+
+// newTestServer starts a test server with config, which gets a fresh host key.
+// A nil config accepts any client. The server is stopped when the test ends.
+func newTestServer(t *testing.T, config *ssh.ServerConfig) *testServer {
+	t.Helper()
+	if config == nil {
+		config = &ssh.ServerConfig{NoClientAuth: true}
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AddHostKey(hostKey)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{addr: ln.Addr().String(), hostKey: hostKey, config: config, ln: ln}
+	s.wg.Go(s.serve)
+	t.Cleanup(func() {
+		_ = ln.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+// clientConfig returns a client config that trusts the server's host key.
+func (s *testServer) clientConfig(user string, auth ...ssh.AuthMethod) *ssh.ClientConfig {
+	return &ssh.ClientConfig{User: user, Auth: auth, HostKeyCallback: ssh.FixedHostKey(s.hostKey.PublicKey())}
+}
+
+// dial connects to the server with [DialSSH] and closes the host when the
+// test ends.
+func (s *testServer) dial(t *testing.T) Host {
+	t.Helper()
+	host, err := DialSSH("test", s.addr, s.clientConfig("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = host.Close() })
+	return host
+}
+
+// configEntry returns an SSH config entry that connects alias to the server
+// with the private key in identityFile, followed by the extra lines.
+func (s *testServer) configEntry(alias, identityFile string, extra ...string) string {
+	host, port, _ := net.SplitHostPort(s.addr)
+	entry := fmt.Sprintf("Host %s\n    Hostname %s\n    Port %s\n    User test\n    IdentityFile %s\n    StrictHostKeyChecking no\n",
+		alias, host, port, identityFile)
+	for _, line := range extra {
+		entry += "    " + line + "\n"
+	}
+	return entry
+}
+
+// writeIdentity writes a new private key to a file and returns its path.
+func writeIdentity(t *testing.T) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// newTestSigner returns a signer for a new key.
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Go(func() { s.handle(conn) })
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	defer conn.Close()
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Go(func() {
+		listeners := make(map[uint32]net.Listener)
+		for req := range reqs {
+			serveGlobalRequest(sconn, req, listeners, &wg)
+		}
+		for _, ln := range listeners {
+			_ = ln.Close()
+		}
+	})
+	for nc := range chans {
+		switch nc.ChannelType() {
+		case "session":
+			ch, reqs, err := nc.Accept()
+			if err != nil {
+				continue
+			}
+			wg.Go(func() { serveSession(ch, reqs) })
+		case "direct-tcpip":
+			var msg struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if err := ssh.Unmarshal(nc.ExtraData(), &msg); err != nil {
+				_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			dst, err := net.Dial("tcp", net.JoinHostPort(msg.Host, strconv.FormatUint(uint64(msg.Port), 10)))
+			if err != nil {
+				_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			ch, reqs, err := nc.Accept()
+			if err != nil {
+				_ = dst.Close()
+				continue
+			}
+			go ssh.DiscardRequests(reqs)
+			wg.Go(func() { relay(ch, dst) })
+		default:
+			_ = nc.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// serveGlobalRequest serves tcpip-forward and cancel-tcpip-forward requests
+// by listening on the loopback interface and opening a forwarded-tcpip
+// channel for each accepted connection. Other requests are refused.
+func serveGlobalRequest(sconn *ssh.ServerConn, req *ssh.Request, listeners map[uint32]net.Listener, wg *sync.WaitGroup) {
+	var msg struct {
+		Addr string
+		Port uint32
+	}
+	if req.Type != "tcpip-forward" && req.Type != "cancel-tcpip-forward" || ssh.Unmarshal(req.Payload, &msg) != nil {
+		_ = req.Reply(false, nil)
+		return
+	}
+	if req.Type == "cancel-tcpip-forward" {
+		if ln, ok := listeners[msg.Port]; ok {
+			_ = ln.Close()
+			delete(listeners, msg.Port)
+		}
+		_ = req.Reply(true, nil)
+		return
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.FormatUint(uint64(msg.Port), 10)))
+	if err != nil {
+		_ = req.Reply(false, nil)
+		return
+	}
+	port := uint32(ln.Addr().(*net.TCPAddr).Port)
+	listeners[port] = ln
+	_ = req.Reply(true, binary.BigEndian.AppendUint32(nil, port))
+	wg.Go(func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			origin := conn.RemoteAddr().(*net.TCPAddr)
+			ch, reqs, err := sconn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+				Addr       string
+				Port       uint32
+				OriginAddr string
+				OriginPort uint32
+			}{msg.Addr, port, origin.IP.String(), uint32(origin.Port)}))
+			if err != nil {
+				_ = conn.Close()
+				continue
+			}
+			go ssh.DiscardRequests(reqs)
+			wg.Go(func() { relay(ch, conn) })
+		}
+	})
+}
+
+// serveSession runs the requests of a session channel.
+func serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		switch req.Type {
+		case "exec":
+			_ = req.Reply(true, nil)
+			var cmd struct{ Command string }
+			_ = ssh.Unmarshal(req.Payload, &cmd)
+			if cmd.Command == "sleep" {
+				// Sleep until the client closes the channel.
+				for range reqs {
+				}
+				return
+			}
+			status := uint32(0)
+			if cmd.Command == "env" {
+				_, _ = io.WriteString(ch, "HOME=/home/test\nUSER=test\n")
+			} else {
+				status = 127
+			}
+			exitStatus(ch, status)
+			return
+		case "subsystem":
+			var sub struct{ Name string }
+			_ = ssh.Unmarshal(req.Payload, &sub)
+			if sub.Name != "sftp" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			server, err := sftp.NewServer(ch)
+			if err != nil {
+				return
+			}
+			_ = server.Serve()
+			return
+		default:
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func exitStatus(ch ssh.Channel, status uint32) {
+	_, _ = ch.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, status))
+}
@@ -0,0 +1,87 @@
+package iago
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrVarNotFound is returned by [GetVar] when a host has no variable with the
+// requested key.
+var ErrVarNotFound = errors.New("variable not found")
+
+// VarTypeError is returned by [GetVar] when a host variable holds a value of a
+// different type than the one requested.
+type VarTypeError struct {
+	Host string
+	Key  string
+	Want reflect.Type
+	Got  reflect.Type
+}
+
+func (e VarTypeError) Error() string {
+	return fmt.Sprintf("iago: %s: variable %q has type %v, not %v", e.Host, e.Key, e.Got, e.Want)
+}
+
+// Vars is a concurrency-safe store of host variables. Its zero value is ready
+// to use. [Host] implementations embed it to provide SetVar and GetVar:
+//
+//	type myHost struct {
+//		iago.Vars
+//		// ...
+//	}
+type Vars struct {
+	mu   sync.RWMutex
+	vars map[string]any
+}
+
+// SetVar sets the variable key to val.
+func (v *Vars) SetVar(key string, val any) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.vars == nil {
+		v.vars = make(map[string]any)
+	}
+	v.vars[key] = val
+}
+
+// GetVar returns the value of the variable key, and whether it exists.
+func (v *Vars) GetVar(key string) (val any, ok bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	val, ok = v.vars[key]
+	return val, ok
+}
+
+// GetVar returns the value of the variable key on host as a T. It returns
+// [ErrVarNotFound] if the variable does not exist and a [VarTypeError] if it
+// is not a T:
+//
+//	replicas, err := iago.GetVar[int](host, "replicas")
+func GetVar[T any](host Host, key string) (T, error) {
+	var zero T
+	val, ok := host.GetVar(key)
+	if !ok {
+		return zero, fmt.Errorf("iago: %s: %q: %w", host.Name(), key, ErrVarNotFound)
+	}
+	t, ok := val.(T)
+	if !ok {
+		return zero, VarTypeError{Host: host.Name(), Key: key, Want: reflect.TypeFor[T](), Got: reflect.TypeOf(val)}
+	}
+	return t, nil
+}
+
+// SetVar sets the variable key on host to val. Setting a variable through
+// SetVar rather than [Host.SetVar] fixes its type at compile time, so that a
+// later [GetVar] with the same type parameter finds it.
+func SetVar[T any](host Host, key string, val T) {
+	host.SetVar(key, val)
+}
+
+// seedVars sets the variables in vars on host.
+func seedVars(host Host, vars map[string]any) {
+	for key, val := range vars {
+		host.SetVar(key, val)
+	}
+}
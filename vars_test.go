@@ -0,0 +1,102 @@
+package iago
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// varsHost is a fakeHost backed by a Vars store.
+type varsHost struct {
+	fakeHost
+	*Vars
+}
+
+func (h varsHost) SetVar(key string, val any)    { h.Vars.SetVar(key, val) }
+func (h varsHost) GetVar(key string) (any, bool) { return h.Vars.GetVar(key) }
+func newVarsHost(name string) varsHost {
+	return varsHost{fakeHost: fakeHost{name: name}, Vars: &Vars{}}
+}
+
+func TestVarsConcurrent(t *testing.T) {
+	var vars Vars
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Go(func() {
+			key := fmt.Sprintf("key%d", i%4)
+			vars.SetVar(key, i)
+			if _, ok := vars.GetVar(key); !ok {
+				t.Errorf("GetVar(%s) not found after SetVar", key)
+			}
+		})
+	}
+	wg.Wait()
+	if _, ok := vars.GetVar("missing"); ok {
+		t.Error("GetVar(missing) found, want not found")
+	}
+}
+
+func TestGetVar(t *testing.T) {
+	host := newVarsHost("wrk1")
+	SetVar(host, "replicas", 3)
+	SetVar(host, "role", "leader")
+
+	if got, err := GetVar[int](host, "replicas"); err != nil || got != 3 {
+		t.Errorf("GetVar[int](replicas) = %d, %v, want 3", got, err)
+	}
+	if got, err := GetVar[string](host, "role"); err != nil || got != "leader" {
+		t.Errorf("GetVar[string](role) = %q, %v, want leader", got, err)
+	}
+
+	_, err := GetVar[int](host, "missing")
+	if !errors.Is(err, ErrVarNotFound) {
+		t.Errorf("GetVar[int](missing) error = %v, want %v", err, ErrVarNotFound)
+	}
+
+	_, err = GetVar[int](host, "role")
+	var typeErr VarTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("GetVar[int](role) error = %v, want VarTypeError", err)
+	}
+	if want := `iago: wrk1: variable "role" has type string, not int`; typeErr.Error() != want {
+		t.Errorf("VarTypeError = %q, want %q", typeErr.Error(), want)
+	}
+	// The untyped helpers keep returning zero values on a mismatch.
+	if got := GetIntVar(host, "role"); got != 0 {
+		t.Errorf("GetIntVar(role) = %d, want 0", got)
+	}
+}
+
+func TestSeedVars(t *testing.T) {
+	host := newVarsHost("wrk1")
+	seedVars(host, map[string]any{"role": "replica", "id": 1})
+	seedVars(host, map[string]any{"role": "leader"})
+	if got := GetStringVar(host, "role"); got != "leader" {
+		t.Errorf("role = %q, want leader", got)
+	}
+	if got := GetIntVar(host, "id"); got != 1 {
+		t.Errorf("id = %d, want 1", got)
+	}
+}
+
+func TestGroupDialerSeedVars(t *testing.T) {
+	config, err := ParseSSHConfig("testdata/config-vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := applyGroupOptions(
+		inventoryVars(map[string]map[string]any{"replica1": {"role": "inventory", "id": 1}}),
+		HostVars(map[string]map[string]any{"replica1": {"id": 2}}),
+	)
+	d := newGroupDialer(config, []string{"replica1"}, cfg)
+	host := newVarsHost("replica1")
+	if err := d.seedVars("replica1", host); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{"zone": "a", "region": "eu", "role": "inventory", "id": 2} {
+		if got, _ := host.GetVar(key); got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}